@@ -11,9 +11,40 @@ import (
 type Cache interface {
 	Load(rssUrl, torrentUrl string) (Torrent, bool)
 	Store(rssUrl, torrentUrl string, t Torrent) error
+	LoadInfoHash(rssUrl, infoHash string) (string, bool)
+	StoreInfoHash(rssUrl, infoHash, torrentUrl string) error
+	// LookupInfoHash finds the infohash in all feeds.
+	LookupInfoHash(infoHash string) (rssUrl, torrentUrl string, ok bool)
+	LoadFeedMeta(rssUrl string) (FeedMeta, bool)
+	StoreFeedMeta(rssUrl string, meta FeedMeta) error
+	LoadRejected(rssUrl, torrentUrl string) (string, bool)
+	StoreRejected(rssUrl, torrentUrl, reason string) error
+	LoadEpisode(rssUrl, key string) (EpisodeRecord, bool)
+	// StoreEpisodes stores the record for all the episode keys in one transaction,
+	// the Added time of the records already stored is kept.
+	StoreEpisodes(rssUrl string, keys []string, record EpisodeRecord) error
+	LoadPending(rssUrl string) map[string]PendingEpisode
+	StorePending(rssUrl, key string, pending PendingEpisode) error
+	DeletePending(rssUrl, key string) error
 	Close() error
 }
 
+// infoHashBucket maps infohash -> rss url -> torrent url,
+// the leading zero byte keeps it from clashing with the rss url buckets.
+var infoHashBucket = []byte("\x00infohash")
+
+// feedMetaBucket maps rss url -> FeedMeta of the last response.
+var feedMetaBucket = []byte("\x00feedmeta")
+
+// rejectedBucket maps rss url -> torrent url -> the reason of rejection.
+var rejectedBucket = []byte("\x00rejected")
+
+// episodeBucket maps rss url -> episode key -> EpisodeRecord of the added release.
+var episodeBucket = []byte("\x00episode")
+
+// pendingBucket maps rss url -> episode key -> PendingEpisode held by the hold window.
+var pendingBucket = []byte("\x00pending")
+
 type cache struct {
 	b *bbolt.DB
 }
@@ -93,6 +124,270 @@ func (c *cache) Store(rssUrl, torrentUrl string, t Torrent) error {
 	})
 }
 
+func (c *cache) LoadInfoHash(rssUrl, infoHash string) (string, bool) {
+	var torrentUrl []byte
+	_ = c.b.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(infoHashBucket)
+		if bkt == nil {
+			return nil
+		}
+
+		bkt = bkt.Bucket([]byte(infoHash))
+		if bkt == nil {
+			return nil
+		}
+
+		if v := bkt.Get([]byte(rssUrl)); v != nil {
+			torrentUrl = bytes.Clone(v)
+		}
+
+		return nil
+	})
+
+	return string(torrentUrl), torrentUrl != nil
+}
+
+func (c *cache) LookupInfoHash(infoHash string) (string, string, bool) {
+	var rssUrl, torrentUrl []byte
+	_ = c.b.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(infoHashBucket)
+		if bkt == nil {
+			return nil
+		}
+
+		bkt = bkt.Bucket([]byte(infoHash))
+		if bkt == nil {
+			return nil
+		}
+
+		k, v := bkt.Cursor().First()
+		if k != nil {
+			rssUrl, torrentUrl = bytes.Clone(k), bytes.Clone(v)
+		}
+
+		return nil
+	})
+
+	return string(rssUrl), string(torrentUrl), rssUrl != nil
+}
+
+func (c *cache) StoreInfoHash(rssUrl, infoHash, torrentUrl string) error {
+	return c.b.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(infoHashBucket)
+		if err != nil {
+			return err
+		}
+
+		bkt, err = bkt.CreateBucketIfNotExists([]byte(infoHash))
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put([]byte(rssUrl), []byte(torrentUrl))
+	})
+}
+
+func (c *cache) LoadFeedMeta(rssUrl string) (FeedMeta, bool) {
+	var meta FeedMeta
+	var ok bool
+	_ = c.b.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(feedMetaBucket)
+		if bkt == nil {
+			return nil
+		}
+
+		data := bkt.Get([]byte(rssUrl))
+		if data == nil {
+			return nil
+		}
+
+		ok = gob.NewDecoder(bytes.NewReader(data)).Decode(&meta) == nil
+		return nil
+	})
+
+	return meta, ok
+}
+
+func (c *cache) StoreFeedMeta(rssUrl string, meta FeedMeta) error {
+	return c.b.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(feedMetaBucket)
+		if err != nil {
+			return err
+		}
+
+		buf := bytes.NewBuffer(nil)
+		err = gob.NewEncoder(buf).Encode(meta)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put([]byte(rssUrl), buf.Bytes())
+	})
+}
+
+func (c *cache) LoadRejected(rssUrl, torrentUrl string) (string, bool) {
+	var reason []byte
+	_ = c.b.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(rejectedBucket)
+		if bkt == nil {
+			return nil
+		}
+
+		bkt = bkt.Bucket([]byte(rssUrl))
+		if bkt == nil {
+			return nil
+		}
+
+		if v := bkt.Get([]byte(torrentUrl)); v != nil {
+			reason = bytes.Clone(v)
+		}
+
+		return nil
+	})
+
+	return string(reason), reason != nil
+}
+
+func (c *cache) StoreRejected(rssUrl, torrentUrl, reason string) error {
+	return c.b.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(rejectedBucket)
+		if err != nil {
+			return err
+		}
+
+		bkt, err = bkt.CreateBucketIfNotExists([]byte(rssUrl))
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put([]byte(torrentUrl), []byte(reason))
+	})
+}
+
+func (c *cache) LoadEpisode(rssUrl, key string) (EpisodeRecord, bool) {
+	var record EpisodeRecord
+	var ok bool
+	_ = c.b.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(episodeBucket)
+		if bkt == nil {
+			return nil
+		}
+
+		bkt = bkt.Bucket([]byte(rssUrl))
+		if bkt == nil {
+			return nil
+		}
+
+		data := bkt.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		ok = gob.NewDecoder(bytes.NewReader(data)).Decode(&record) == nil
+		return nil
+	})
+
+	return record, ok
+}
+
+func (c *cache) StoreEpisodes(rssUrl string, keys []string, record EpisodeRecord) error {
+	return c.b.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(episodeBucket)
+		if err != nil {
+			return err
+		}
+
+		bkt, err = bkt.CreateBucketIfNotExists([]byte(rssUrl))
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			// keep the time of the first release, the upgrade window starts from it
+			rec := record
+			var old EpisodeRecord
+			if data := bkt.Get([]byte(key)); data != nil &&
+				gob.NewDecoder(bytes.NewReader(data)).Decode(&old) == nil && !old.Added.IsZero() {
+				rec.Added = old.Added
+			}
+
+			buf := bytes.NewBuffer(nil)
+			err = gob.NewEncoder(buf).Encode(rec)
+			if err != nil {
+				return err
+			}
+
+			if err := bkt.Put([]byte(key), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *cache) LoadPending(rssUrl string) map[string]PendingEpisode {
+	m := make(map[string]PendingEpisode)
+	_ = c.b.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(pendingBucket)
+		if bkt == nil {
+			return nil
+		}
+
+		bkt = bkt.Bucket([]byte(rssUrl))
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			var pending PendingEpisode
+			if gob.NewDecoder(bytes.NewReader(v)).Decode(&pending) == nil {
+				m[string(k)] = pending
+			}
+			return nil
+		})
+	})
+
+	return m
+}
+
+func (c *cache) StorePending(rssUrl, key string, pending PendingEpisode) error {
+	return c.b.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists(pendingBucket)
+		if err != nil {
+			return err
+		}
+
+		bkt, err = bkt.CreateBucketIfNotExists([]byte(rssUrl))
+		if err != nil {
+			return err
+		}
+
+		buf := bytes.NewBuffer(nil)
+		err = gob.NewEncoder(buf).Encode(pending)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put([]byte(key), buf.Bytes())
+	})
+}
+
+func (c *cache) DeletePending(rssUrl, key string) error {
+	return c.b.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(pendingBucket)
+		if bkt == nil {
+			return nil
+		}
+
+		bkt = bkt.Bucket([]byte(rssUrl))
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.Delete([]byte(key))
+	})
+}
+
 func (c *cache) Close() error {
 	return c.b.Close()
 }
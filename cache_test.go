@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	gotorrentparser "github.com/j-muller/go-torrent-parser"
 	"github.com/stretchr/testify/require"
@@ -39,4 +41,55 @@ func TestCache(t *testing.T) {
 	require.True(t, ok)
 
 	_ = json.NewEncoder(os.Stdout).Encode(tt)
+
+	require.NoError(t, cache.StoreInfoHash("test://rss_url", "abcdef", "test://torrent_url"))
+
+	torrentUrl, ok := cache.LoadInfoHash("test://rss_url", "abcdef")
+	require.True(t, ok)
+	require.Equal(t, "test://torrent_url", torrentUrl)
+
+	_, ok = cache.LoadInfoHash("test://rss_url_2", "abcdef")
+	require.False(t, ok)
+
+	rssUrl, torrentUrl, ok := cache.LookupInfoHash("abcdef")
+	require.True(t, ok)
+	require.Equal(t, "test://rss_url", rssUrl)
+	require.Equal(t, "test://torrent_url", torrentUrl)
+
+	_, _, ok = cache.LookupInfoHash("fedcba")
+	require.False(t, ok)
+
+	require.NoError(t, cache.StoreEpisodes("test://rss_url", []string{"show|S01E07", "show|S01E08"}, EpisodeRecord{Title: "show - 07~08", InfoHash: "abcdef"}))
+
+	record, ok := cache.LoadEpisode("test://rss_url", "show|S01E07")
+	require.True(t, ok)
+	require.Equal(t, "abcdef", record.InfoHash)
+
+	record, ok = cache.LoadEpisode("test://rss_url", "show|S01E08")
+	require.True(t, ok)
+	require.Equal(t, "abcdef", record.InfoHash)
+
+	_, ok = cache.LoadEpisode("test://rss_url_2", "show|S01E07")
+	require.False(t, ok)
+
+	require.NoError(t, cache.StorePending("test://rss_url", "show|S01E08", PendingEpisode{Items: []Item{{Title: "show - 08"}}}))
+	require.Equal(t, "show - 08", cache.LoadPending("test://rss_url")["show|S01E08"].Items[0].Title)
+
+	require.NoError(t, cache.DeletePending("test://rss_url", "show|S01E08"))
+	require.NotContains(t, cache.LoadPending("test://rss_url"), "show|S01E08")
+}
+
+func TestStoreEpisodesKeepAdded(t *testing.T) {
+	cache, err := NewCacheByPath(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer cache.Close()
+
+	added := time.Now().Add(-time.Hour).Round(0)
+	require.NoError(t, cache.StoreEpisodes("test://rss_url", []string{"show|S01E09"}, EpisodeRecord{Title: "show - 09", Added: added}))
+	require.NoError(t, cache.StoreEpisodes("test://rss_url", []string{"show|S01E09"}, EpisodeRecord{Title: "show - 09 1080p", Added: time.Now()}))
+
+	record, ok := cache.LoadEpisode("test://rss_url", "show|S01E09")
+	require.True(t, ok)
+	require.Equal(t, "show - 09 1080p", record.Title)
+	require.True(t, added.Equal(record.Added))
 }
@@ -3,17 +3,25 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/hekmon/transmissionrpc/v3"
 	gtp "github.com/j-muller/go-torrent-parser"
+	"github.com/samber/lo"
 )
 
 type Channel struct {
@@ -21,6 +29,10 @@ type Channel struct {
 	Url      string
 	Describe string
 
+	// Next is the url of the next page, NextOffset is the offset of the next page of torznab feeds.
+	Next       string
+	NextOffset int
+
 	Items []Item
 }
 
@@ -29,46 +41,250 @@ type Item struct {
 	ContentType string
 	Url         string
 	Describe    string
+	GUID        string
 	PubDate     time.Time
+
+	// RawPubDate is the date string of the feed, InvalidPubDate is set when it can't be parsed.
+	RawPubDate     string
+	InvalidPubDate bool
+
+	// HasSeeders is set when the feed reports the seeders of the item.
+	HasSeeders bool
+	Seeders    int
+	Peers      int
+	Size       int64
+	InfoHash   string
+	MagnetUrl  string
+	Categories []string
+	Trusted    bool
+	Remake     bool
+
+	// Links are the download url candidates of the item, keyed by the UrlSource*.
+	Links map[string]ItemLink
+}
+
+func (i *Item) SetPubDate(s string) {
+	i.RawPubDate = s
+	t, err := ParseTime(s)
+	i.PubDate = t
+	i.InvalidPubDate = err != nil
+}
+
+type ItemLink struct {
+	Url         string
+	ContentType string
+}
+
+const (
+	UrlSourceEnclosure = "enclosure"
+	UrlSourceTorrent   = "torrent"
+	UrlSourceMagnet    = "magnet"
+	UrlSourceLink      = "link"
+	UrlSourceGUID      = "guid"
+)
+
+// defaultUrlSources is the resolution order without url_sources,
+// the link is only used when it looks like a torrent or magnet url.
+var defaultUrlSources = []string{UrlSourceEnclosure, UrlSourceTorrent, UrlSourceMagnet, UrlSourceLink}
+
+// AddLink adds a download url candidate, the first one of a source wins.
+// Links and guids are only added when they look like a http or magnet url.
+func (i *Item) AddLink(source, url, contentType string) {
+	if url == "" {
+		return
+	}
+
+	if (source == UrlSourceLink || source == UrlSourceGUID) && !isDownloadUrl(url) {
+		return
+	}
+
+	if i.Links == nil {
+		i.Links = make(map[string]ItemLink)
+	}
+
+	if _, ok := i.Links[source]; !ok {
+		i.Links[source] = ItemLink{Url: url, ContentType: contentType}
+	}
+}
+
+// ResolveUrl picks the download url from the links by the order of sources,
+// nil sources means the defaultUrlSources.
+func (i *Item) ResolveUrl(sources []string, preferMagnet bool) bool {
+	torrentLinkOnly := sources == nil
+	if torrentLinkOnly {
+		sources = defaultUrlSources
+	}
+
+	if preferMagnet {
+		sources = append([]string{UrlSourceMagnet}, sources...)
+	}
+
+	if magnet, ok := i.Links[UrlSourceMagnet]; ok && i.InfoHash == "" {
+		i.InfoHash = TorrentHash(magnet.Url).InfoHash()
+	}
+
+	for _, source := range sources {
+		link, ok := i.Links[source]
+		if !ok {
+			continue
+		}
+
+		if torrentLinkOnly && source == UrlSourceLink && !isTorrentUrl(link.Url) {
+			continue
+		}
+
+		i.Url = link.Url
+		i.ContentType = link.ContentType
+		return true
+	}
+
+	i.Url = ""
+	i.ContentType = ""
+	return false
 }
 
-func (i *Item) Get(ctx context.Context) (Torrent, error) {
+func isDownloadUrl(s string) bool {
+	return strings.HasPrefix(s, "magnet:?") || strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// isTorrentUrl reports whether s is a magnet link or a url of a .torrent file.
+func isTorrentUrl(s string) bool {
+	if strings.HasPrefix(s, "magnet:?") {
+		return true
+	}
+
+	uri, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasSuffix(strings.ToLower(uri.Path), ".torrent")
+}
+
+// ErrLocalUrl is returned when a file:// url comes from a source which is not local.
+var ErrLocalUrl = errors.New("file url is only allowed for the local sources")
+
+// Get downloads the torrent of the item, the body larger than maxSize is rejected, zero means no limit.
+// The file:// urls are only read when allowLocal is set, it's only for the items of the local sources.
+func (i *Item) Get(ctx context.Context, client HTTPClient, maxSize int64, allowLocal bool) (Torrent, error) {
 	if strings.HasPrefix(i.Url, "magnet:?xt=") {
 		return TorrentHash(i.Url), nil
 	}
 
+	if strings.HasPrefix(i.Url, "file://") {
+		if !allowLocal {
+			return nil, ErrLocalUrl
+		}
+
+		path, err := localPath(i.Url)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open torrent file failed: %w", err)
+		}
+		defer f.Close()
+
+		data, err := io.ReadAll(newLimitedReader(f, maxSize))
+		if err != nil {
+			return nil, fmt.Errorf("read torrent file failed: %w", err)
+		}
+
+		tr, err := ParseTorrent(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse torrent failed: %w", err)
+		}
+
+		return tr, nil
+	}
+
 	req, err := http.NewRequestWithContext(ctx, "GET", i.Url, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", i.ContentType)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
+		// http.Client can't follow the redirect to a magnet link, but the url error has it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) && strings.HasPrefix(urlErr.URL, "magnet:?") {
+			return TorrentHash(urlErr.URL), nil
+		}
+
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: status code: %d", ErrAuthRequired, resp.StatusCode)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(newLimitedReader(resp.Body, maxSize))
 	if err != nil {
 		return nil, fmt.Errorf("read body failed: %w", err)
 	}
 
 	tr, err := ParseTorrent(data)
 	if err != nil {
-		return nil, fmt.Errorf("parse torrent failed: %w, data: %s", err, data)
+		return classifyResponse(resp, data, err)
 	}
 
 	return tr, nil
 }
 
+// ErrAuthRequired is returned when the tracker responds a login page instead of the torrent,
+// usually the cookie or credentials of the feed are expired.
+var ErrAuthRequired = errors.New("authentication required")
+
+// classifyResponse sniffs the body that is not a torrent, it may be a magnet link,
+// a login page or a json error of the tracker.
+func classifyResponse(resp *http.Response, data []byte, parseErr error) (Torrent, error) {
+	trimmed := bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(trimmed, []byte("magnet:?")) {
+		return TorrentHash(trimmed), nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	switch {
+	case mediaType == "text/html" || strings.HasPrefix(http.DetectContentType(trimmed), "text/html"):
+		lower := bytes.ToLower(trimmed)
+		if bytes.Contains(lower, []byte(`type="password"`)) || bytes.Contains(lower, []byte(`type='password'`)) ||
+			bytes.Contains(lower, []byte(`type=password`)) ||
+			(resp.Request != nil && strings.Contains(strings.ToLower(resp.Request.URL.Path), "login")) {
+			return nil, fmt.Errorf("%w: got a login page", ErrAuthRequired)
+		}
+
+		return nil, fmt.Errorf("unexpected html page: %s", truncate(trimmed, 256))
+
+	case mediaType == "application/json" || bytes.HasPrefix(trimmed, []byte("{")):
+		var body map[string]any
+		if json.Unmarshal(trimmed, &body) == nil {
+			for _, key := range []string{"error", "message", "msg", "detail"} {
+				if v, ok := body[key]; ok && v != nil && v != false {
+					return nil, fmt.Errorf("tracker error: %v", v)
+				}
+			}
+		}
+
+		return nil, fmt.Errorf("unexpected json response: %s", truncate(trimmed, 256))
+	}
+
+	return nil, fmt.Errorf("parse torrent failed: %w, data: %s", parseErr, truncate(data, 256))
+}
+
 type RSS struct {
 	Disabled      bool     `json:"disabled,omitempty" toml:"disabled"`
 	Name          string   `json:"name,omitempty" toml:"name"`
+	Type          string   `json:"type,omitempty" toml:"type"`
 	Url           string   `json:"url,omitempty" toml:"url"`
 	DownloadDir   string   `json:"download_dir,omitempty" toml:"download_dir"`
 	Internal      int      `json:"internal,omitempty" toml:"internal"`
@@ -78,11 +294,61 @@ type RSS struct {
 	ExpireTime    int64    `json:"expire_time,omitempty" toml:"expire_time"`
 	FetchInterval int64    `json:"fetch_interval,omitempty" toml:"fetch_interval"`
 	Label         []string `json:"label,omitempty" toml:"label"`
+	MinSeeders    int      `json:"min_seeders,omitempty" toml:"min_seeders"`
+	Categories    []string `json:"categories,omitempty" toml:"categories"`
+	TrustedOnly   bool     `json:"trusted_only,omitempty" toml:"trusted_only"`
+	ExcludeRemake bool     `json:"exclude_remake,omitempty" toml:"exclude_remake"`
+	MinSize       Size     `json:"min_size,omitempty" toml:"min_size"`
+	MaxSize       Size     `json:"max_size,omitempty" toml:"max_size"`
+	UrlSources    []string `json:"url_sources,omitempty" toml:"url_sources"`
+	PreferMagnet  bool     `json:"prefer_magnet,omitempty" toml:"prefer_magnet"`
+	DateLayout    string   `json:"date_layout,omitempty" toml:"date_layout"`
+	Timezone      string   `json:"timezone,omitempty" toml:"timezone"`
+
+	Username string            `json:"username,omitempty" toml:"username"`
+	Password string            `json:"password,omitempty" toml:"password"`
+	Cookie   string            `json:"cookie,omitempty" toml:"cookie"`
+	Headers  map[string]string `json:"headers,omitempty" toml:"headers"`
+
+	ClientConfig
+
+	Scrape *ScrapeRule `json:"scrape,omitempty" toml:"scrape"`
+
+	// Backfill follows the next pages once until download_after is reached, at most BackfillPages pages.
+	Backfill      bool `json:"backfill,omitempty" toml:"backfill"`
+	BackfillPages int  `json:"backfill_pages,omitempty" toml:"backfill_pages"`
+
+	// BlockDangerous rejects the torrents with executables or only archives.
+	BlockDangerous    bool     `json:"block_dangerous,omitempty" toml:"block_dangerous"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty" toml:"allowed_extensions"`
+	// VerifyInfoHash rejects the torrents whose infohash doesn't match the one of the feed.
+	VerifyInfoHash bool `json:"verify_infohash,omitempty" toml:"verify_infohash"`
+
+	// DedupAcrossFeeds treats the torrents already added by any feed as downloaded, default true.
+	DedupAcrossFeeds *bool `json:"dedup_across_feeds,omitempty" toml:"dedup_across_feeds"`
+
+	// TrackEpisodes downloads each episode parsed from the titles only once,
+	// AllowUpgrades still adds the releases of the episodes already obtained.
+	TrackEpisodes bool `json:"track_episodes,omitempty" toml:"track_episodes"`
+	AllowUpgrades bool `json:"allow_upgrades,omitempty" toml:"allow_upgrades"`
+	// Quality limits the upgrades to the better ranked releases within UpgradeWindow minutes.
+	Quality       *QualityPreference `json:"quality,omitempty" toml:"quality"`
+	UpgradeWindow int64              `json:"upgrade_window,omitempty" toml:"upgrade_window"`
+	// RemoveOld removes the torrent replaced by an upgrade or a v2/PROPER/REPACK release from transmission,
+	// RemoveOldData also deletes its downloaded data.
+	RemoveOld     bool `json:"remove_old,omitempty" toml:"remove_old"`
+	RemoveOldData bool `json:"remove_old_data,omitempty" toml:"remove_old_data"`
+
+	// HoldWindow holds the releases of an episode for minutes after the first one is seen,
+	// then the best one by GroupPriority, Quality and seeders is added.
+	HoldWindow    int64    `json:"hold_window,omitempty" toml:"hold_window"`
+	GroupPriority []string `json:"group_priority,omitempty" toml:"group_priority"`
 
 	regexp        regexps
 	excludeRegexp regexps
 	downloadAfter time.Time
 	expireTime    time.Time
+	location      *time.Location
 }
 
 type regexps []*regexp.Regexp
@@ -129,6 +395,65 @@ func (r *RSS) MatchDate(pubDate time.Time) bool {
 	return pubDate.After(r.downloadAfter)
 }
 
+// ParsePubDate parses the date of the item again by the feed's date layout and timezone.
+func (r *RSS) ParsePubDate(item *Item) {
+	if (r.DateLayout == "" && r.Timezone == "") || item.RawPubDate == "" {
+		return
+	}
+
+	if r.location == nil {
+		r.location = loadLocation(r.Timezone)
+	}
+
+	var layouts []string
+	if r.DateLayout != "" {
+		layouts = append(layouts, r.DateLayout)
+	}
+
+	t, err := ParseTimeIn(item.RawPubDate, layouts, r.location)
+	item.PubDate = t
+	item.InvalidPubDate = err != nil
+}
+
+// loadLocation loads a IANA time zone name like "Asia/Tokyo" or a fixed offset like "+09:00".
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc
+	}
+
+	for _, layout := range []string{"-07:00", "-0700", "-07"} {
+		t, err := time.Parse(layout, name)
+		if err == nil {
+			_, offset := t.Zone()
+			return time.FixedZone(name, offset)
+		}
+	}
+
+	slog.Error("load timezone failed, fallback to UTC", "timezone", name)
+	return time.UTC
+}
+
+const defaultBackfillPages = 10
+
+func (r *RSS) backfillPages() int {
+	if r.BackfillPages > 0 {
+		return r.BackfillPages
+	}
+
+	return defaultBackfillPages
+}
+
+// Fingerprint returns the hash of the config, it changes when any option of the feed is edited.
+func (r *RSS) Fingerprint() string {
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func (r *RSS) ExpiredOrDisabled() bool {
 	if r.Disabled {
 		return true
@@ -145,6 +470,63 @@ func (r *RSS) ExpiredOrDisabled() bool {
 	return r.expireTime.Before(time.Now())
 }
 
+// ResolveUrl sets the download url of the item by the feed's url sources.
+func (r *RSS) ResolveUrl(item *Item) bool {
+	if len(r.UrlSources) == 0 && !r.PreferMagnet {
+		return item.Url != ""
+	}
+
+	var sources []string
+	if len(r.UrlSources) != 0 {
+		sources = r.UrlSources
+	}
+
+	return item.ResolveUrl(sources, r.PreferMagnet)
+}
+
+// MatchAttr checks the item against the indexer attributes filters, like seeders, categories and trusted.
+// MinSeeders is ignored for the items without seeders.
+func (r *RSS) MatchAttr(item Item) bool {
+	if r.MinSeeders > 0 && item.HasSeeders && item.Seeders < r.MinSeeders {
+		return false
+	}
+
+	if len(r.Categories) > 0 && !lo.Some(item.Categories, r.Categories) {
+		return false
+	}
+
+	if r.TrustedOnly && !item.Trusted {
+		return false
+	}
+
+	if r.ExcludeRemake && item.Remake {
+		return false
+	}
+
+	if !r.MatchSize(item.Size) {
+		return false
+	}
+
+	return true
+}
+
+// MatchSize checks the size by min_size and max_size, the unknown zero size always matches.
+func (r *RSS) MatchSize(size int64) bool {
+	if size <= 0 {
+		return true
+	}
+
+	if r.MinSize > 0 && size < int64(r.MinSize) {
+		return false
+	}
+
+	if r.MaxSize > 0 && size > int64(r.MaxSize) {
+		return false
+	}
+
+	return true
+}
+
 func (r *RSS) Match(title string) bool {
 	if r.regexp == nil {
 		r.regexp = newRegexps(r.Regexp)
@@ -166,15 +548,27 @@ func (r *RSS) Match(title string) bool {
 }
 
 type Config struct {
+	ClientConfig
+
 	Rss []*RSS `json:"rss,omitempty" toml:"rss"`
 }
 
 type Torrent interface {
 	AddPayload(downloadDir string, labels []string) transmissionrpc.TorrentAddPayload
+	// InfoHash returns the lowercase hex infohash, or an empty string when it's unknown.
+	InfoHash() string
 }
 
 type TorrentHash string
 
+func (th TorrentHash) InfoHash() string {
+	m, err := ParseMagnet(string(th))
+	if err != nil {
+		return ""
+	}
+	return m.InfoHash
+}
+
 func (th TorrentHash) AddPayload(downloadDir string, labels []string) transmissionrpc.TorrentAddPayload {
 	return transmissionrpc.TorrentAddPayload{
 		DownloadDir: &downloadDir,
@@ -188,6 +582,14 @@ type TorrentFile struct {
 	Bytes   []byte
 }
 
+// InfoHash returns the sha1 of the info dict computed by the parser.
+func (tr *TorrentFile) InfoHash() string {
+	if tr.Torrent == nil {
+		return ""
+	}
+	return strings.ToLower(tr.Torrent.InfoHash)
+}
+
 func (tr *TorrentFile) AddPayload(downloadDir string, labels []string) transmissionrpc.TorrentAddPayload {
 	str := base64.StdEncoding.EncodeToString(tr.Bytes)
 	return transmissionrpc.TorrentAddPayload{
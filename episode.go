@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Episode is the show, season and episode parsed from the title,
+// Last is set for the batch releases covering Episode to Last.
+// Revision counts the fixes of the release, like v2 or PROPER/REPACK.
+type Episode struct {
+	Show     string
+	Season   int
+	Episode  int
+	Last     int
+	Version  int
+	Revision int
+}
+
+var (
+	seasonEpisodeRe = regexp.MustCompile(`(?i)\bS(\d{1,2})[ ._]?E(\d{1,4})(?:[ ._]?-?[ ._]?E(\d{1,4}))?(?:v(\d))?\b`)
+	crossEpisodeRe  = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})(?:v(\d))?\b`)
+	// the anime absolute numbering, like "Show - 07", "Show - 07v2" or "Show - 01~12",
+	// at most 3 digits so a year like "Show - 01 - 2024" isn't taken as a batch
+	dashEpisodeRe = regexp.MustCompile(`\s-\s(\d{1,3})(?:\s?[-~]\s?(\d{1,3}))?(?:v(\d))?(?:[\s\[(]|$)`)
+	// the anime absolute numbering in brackets, like "[Group] Show [07][1080p]"
+	bracketEpisodeRe = regexp.MustCompile(`\[(\d{1,3})(?:v(\d))?\]`)
+
+	bracketTagRe  = regexp.MustCompile(`[\[(【][^\])】]*[\])】]`)
+	showSeasonRe  = regexp.MustCompile(`(?i)\s(?:S|Season\s?)(\d{1,2})$`)
+	showSpaceRe   = regexp.MustCompile(`[\s._]+`)
+	revisionRe    = regexp.MustCompile(`(?i)\b(?:PROPER|REPACK|RERIP)(\d)?\b`)
+	leadingTagsRe = regexp.MustCompile(`^(?:\s*[\[(【][^\])】]*[\])】])+`)
+)
+
+// maxBatchEpisodes is the most episodes of a batch release, larger ranges are not parsed as episodes.
+const maxBatchEpisodes = 200
+
+// ParseEpisode parses the title into the episode, the anime absolute numbering is
+// treated as the first season unless the show ends with a season like "S2".
+func ParseEpisode(title string) (Episode, bool) {
+	if m := seasonEpisodeRe.FindStringSubmatchIndex(title); m != nil {
+		return newEpisode(title, m, 2, 4, 6, 8)
+	}
+
+	if m := crossEpisodeRe.FindStringSubmatchIndex(title); m != nil {
+		return newEpisode(title, m, 2, 4, -1, 6)
+	}
+
+	// skip the leading group tags, or the bracket numbering may match a tag like [01]
+	start := len(leadingTagsRe.FindString(title))
+	rest := title[start:]
+
+	if m := dashEpisodeRe.FindStringSubmatchIndex(rest); m != nil {
+		return newEpisode(rest, m, -1, 2, 4, 6)
+	}
+
+	if m := bracketEpisodeRe.FindStringSubmatchIndex(rest); m != nil {
+		return newEpisode(rest, m, -1, 2, -1, 4)
+	}
+
+	return Episode{}, false
+}
+
+// newEpisode builds the episode by the submatch indexes of the groups, -1 means the group doesn't exist.
+func newEpisode(title string, m []int, season, episode, last, version int) (Episode, bool) {
+	group := func(i int) int {
+		if i < 0 || m[i] < 0 {
+			return 0
+		}
+		n, _ := strconv.Atoi(title[m[i]:m[i+1]])
+		return n
+	}
+
+	ep := Episode{
+		Show:    title[:m[0]],
+		Season:  group(season),
+		Episode: group(episode),
+		Last:    group(last),
+		Version: group(version),
+	}
+
+	ep.Show = bracketTagRe.ReplaceAllString(ep.Show, " ")
+	ep.Show = strings.TrimSpace(showSpaceRe.ReplaceAllString(ep.Show, " "))
+
+	if season < 0 {
+		ep.Season = 1
+		if sm := showSeasonRe.FindStringSubmatch(ep.Show); sm != nil {
+			ep.Season, _ = strconv.Atoi(sm[1])
+			ep.Show = ep.Show[:len(ep.Show)-len(sm[0])]
+		}
+	}
+
+	ep.Show = strings.ToLower(strings.Trim(ep.Show, " -"))
+	if ep.Show == "" {
+		return Episode{}, false
+	}
+
+	if ep.Last <= ep.Episode {
+		ep.Last = 0
+	} else if ep.Last-ep.Episode >= maxBatchEpisodes {
+		return Episode{}, false
+	}
+
+	ep.Revision = max(ep.Version-1, 0)
+	if rm := revisionRe.FindStringSubmatch(title[m[1]:]); rm != nil {
+		n, _ := strconv.Atoi(rm[1])
+		ep.Revision = max(ep.Revision, n, 1)
+	}
+
+	return ep, true
+}
+
+// Keys returns the cache keys of all the episodes covered by the release.
+func (e Episode) Keys() []string {
+	last := max(e.Last, e.Episode)
+
+	keys := make([]string, 0, last-e.Episode+1)
+	for i := e.Episode; i <= last; i++ {
+		keys = append(keys, fmt.Sprintf("%s|S%02dE%02d", e.Show, e.Season, i))
+	}
+	return keys
+}
+
+// Key returns the cache key of the release, the batch releases are keyed by the range.
+func (e Episode) Key() string {
+	if e.Last > 0 {
+		return fmt.Sprintf("%s|S%02dE%02d-E%02d", e.Show, e.Season, e.Episode, e.Last)
+	}
+	return fmt.Sprintf("%s|S%02dE%02d", e.Show, e.Season, e.Episode)
+}
+
+func (e Episode) String() string {
+	if e.Last > 0 {
+		return fmt.Sprintf("%s S%02dE%02d-E%02d", e.Show, e.Season, e.Episode, e.Last)
+	}
+	return fmt.Sprintf("%s S%02dE%02d", e.Show, e.Season, e.Episode)
+}
+
+// Revises reports whether the item is a newer revision of all the added releases of the episode,
+// they must be from the same release group, and it must not rank worse by the quality preference.
+func (r *RSS) Revises(item Item, episode Episode, records []EpisodeRecord) bool {
+	if episode.Revision == 0 {
+		return false
+	}
+
+	group := ParseGroup(item.Title)
+	quality := ParseQuality(item.Title)
+
+	for _, record := range records {
+		if !strings.EqualFold(ParseGroup(record.Title), group) {
+			return false
+		}
+
+		ep, ok := ParseEpisode(record.Title)
+		if ok && ep.Revision >= episode.Revision {
+			return false
+		}
+
+		if r.Quality != nil && r.Quality.Compare(quality, ParseQuality(record.Title)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// EpisodeRecord is the release added for an episode.
+type EpisodeRecord struct {
+	Title      string
+	TorrentUrl string
+	InfoHash   string
+	Added      time.Time
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEpisode(t *testing.T) {
+	for title, want := range map[string]Episode{
+		"Show.Name.S01E07.1080p.WEB-DL.x264-GRP":             {Show: "show name", Season: 1, Episode: 7},
+		"Show Name S02E03-E04 720p":                          {Show: "show name", Season: 2, Episode: 3, Last: 4},
+		"Show Name 3x12 HDTV":                                {Show: "show name", Season: 3, Episode: 12},
+		"[SubsPlease] Show Name - 07 (1080p) [ABCDEF01].mkv": {Show: "show name", Season: 1, Episode: 7},
+		"[Group] Show Name S2 - 07v2 [1080p]":                {Show: "show name", Season: 2, Episode: 7, Version: 2, Revision: 1},
+		"[Group] Show Name - 01~12 [Batch]":                  {Show: "show name", Season: 1, Episode: 1, Last: 12},
+		"[Group][01] Show Name [07][1080p][CHS]":             {Show: "show name", Season: 1, Episode: 7},
+		"【Group】Show Name [07v2][1080p]":                     {Show: "show name", Season: 1, Episode: 7, Version: 2, Revision: 1},
+		"[Group] Show Name - 01 - 2024 [1080p]":              {Show: "show name", Season: 1, Episode: 1},
+	} {
+		ep, ok := ParseEpisode(title)
+		require.True(t, ok, title)
+		require.Equal(t, want, ep, title)
+	}
+
+	_, ok := ParseEpisode("[Group] Show Name The Movie [1080p]")
+	require.False(t, ok)
+
+	_, ok = ParseEpisode("Show Name S01E01-E999 1080p")
+	require.False(t, ok)
+
+	ep, _ := ParseEpisode("[Group] Show Name - 01-03")
+	require.Equal(t, []string{"show name|S01E01", "show name|S01E02", "show name|S01E03"}, ep.Keys())
+}
+
+func TestEpisodeRevision(t *testing.T) {
+	for title, revision := range map[string]int{
+		"Show.S01E07.PROPER.1080p.WEB-DL-GRP":  1,
+		"Show.S01E07.REPACK2.1080p.WEB-DL-GRP": 2,
+		"[Group] Show - 07v3 [1080p]":          2,
+		"[Group] Show - 07 [1080p]":            0,
+		"[Proper] Show - 07 [1080p]":           0,
+	} {
+		ep, ok := ParseEpisode(title)
+		require.True(t, ok, title)
+		require.Equal(t, revision, ep.Revision, title)
+	}
+
+	r := &RSS{}
+	v2 := Item{Title: "[Group] Show - 07v2 [1080p]"}
+	ep, _ := ParseEpisode(v2.Title)
+	require.True(t, r.Revises(v2, ep, []EpisodeRecord{{Title: "[Group] Show - 07 [1080p]"}}))
+	require.False(t, r.Revises(v2, ep, []EpisodeRecord{{Title: "[Group] Show - 07v2 [1080p]"}}))
+	require.False(t, r.Revises(v2, ep, []EpisodeRecord{{Title: "[Other] Show - 07 [1080p]"}}))
+
+	original := Item{Title: "[Group] Show - 07 [1080p]"}
+	ep, _ = ParseEpisode(original.Title)
+	require.False(t, r.Revises(original, ep, []EpisodeRecord{{Title: "[Group] Show - 07 [720p]"}}))
+
+	repack := Item{Title: "Show.S01E07.REPACK.480p.WEB-DL-GRP"}
+	ep, _ = ParseEpisode(repack.Title)
+	records := []EpisodeRecord{{Title: "Show.S01E07.1080p.WEB-DL-GRP"}}
+	require.True(t, r.Revises(repack, ep, records))
+
+	r.Quality = &QualityPreference{Resolution: []string{"1080p", "720p"}}
+	require.False(t, r.Revises(repack, ep, records))
+}
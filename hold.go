@@ -0,0 +1,129 @@
+package main
+
+import (
+	"cmp"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PendingEpisode is the candidates of an episode held until the hold window expires.
+type PendingEpisode struct {
+	FirstSeen time.Time
+	Items     []Item
+}
+
+var (
+	leadingGroupRe = regexp.MustCompile(`^\s*[\[【]([^\]】]+)[\]】]`)
+	sceneGroupRe   = regexp.MustCompile(`-([A-Za-z0-9]+)(?:\.(?:mkv|mp4|avi))?$`)
+)
+
+// ParseGroup returns the release group of the title, like "[Group] Show - 07" or "Show.S01E07-GROUP".
+func ParseGroup(title string) string {
+	if m := leadingGroupRe.FindStringSubmatch(title); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+
+	if m := sceneGroupRe.FindStringSubmatch(strings.TrimSpace(title)); m != nil {
+		return m[1]
+	}
+
+	return ""
+}
+
+func (r *RSS) groupRank(title string) int {
+	group := ParseGroup(title)
+	for i, v := range r.GroupPriority {
+		if group != "" && strings.EqualFold(v, group) {
+			return i
+		}
+	}
+	return len(r.GroupPriority)
+}
+
+// CompareCandidates returns a negative number if a is the better release, it's ranked
+// by the group priority, the quality preference and then more seeders.
+func (r *RSS) CompareCandidates(a, b Item) int {
+	if c := cmp.Compare(r.groupRank(a.Title), r.groupRank(b.Title)); c != 0 {
+		return c
+	}
+
+	if r.Quality != nil {
+		if c := r.Quality.Compare(ParseQuality(a.Title), ParseQuality(b.Title)); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(b.Seeders, a.Seeders)
+}
+
+// hold parks the item as a candidate of the episode.
+func (j *Job) hold(v *RSS, episode Episode, item Item) error {
+	key := episode.Key()
+
+	pending, ok := j.cache.LoadPending(v.Url)[key]
+	if !ok {
+		pending.FirstSeen = time.Now()
+		slog.Info("hold episode", "rss", v.Name, "episode", episode, "window", v.HoldWindow)
+	}
+
+	if slices.ContainsFunc(pending.Items, func(i Item) bool { return i.Url == item.Url }) {
+		return nil
+	}
+
+	pending.Items = append(pending.Items, item)
+	return j.cache.StorePending(v.Url, key, pending)
+}
+
+// releasePending adds the best candidate of each episode whose hold window expired, the next best one
+// is tried when it fails. The pending episode is kept for the next run if none of them is added with errors,
+// otherwise it's deleted and the other candidates are recorded as rejected so they are not held again.
+func (j *Job) releasePending(f *Feed) {
+	v := f.Rss
+
+	for key, pending := range j.cache.LoadPending(v.Url) {
+		if time.Since(pending.FirstSeen) < time.Duration(v.HoldWindow)*time.Minute {
+			continue
+		}
+
+		items := slices.Clone(pending.Items)
+		slices.SortStableFunc(items, v.CompareCandidates)
+
+		winner, failed := -1, false
+		for i, item := range items {
+			slog.Info("release held episode", "rss", v.Name, "episode", key, "name", item.Title, "candidates", len(items))
+
+			if err := j.process(f, item, false); err != nil {
+				slog.Error("process item failed", "url", item.Url, "name", v.Name, "err", err)
+				j.setFeedError(v, err)
+				failed = true
+				continue
+			}
+
+			if _, ok := j.cache.Load(v.Url, item.Url); ok {
+				winner = i
+				break
+			}
+		}
+
+		if winner < 0 && failed {
+			continue
+		}
+
+		for i, item := range items {
+			if winner < 0 || i == winner {
+				continue
+			}
+
+			if err := j.cache.StoreRejected(v.Url, item.Url, "not the best release of "+key); err != nil {
+				slog.Error("store rejected torrent failed", "err", err, "url", item.Url, "name", item.Title)
+			}
+		}
+
+		if err := j.cache.DeletePending(v.Url, key); err != nil {
+			slog.Error("delete pending episode failed", "err", err, "rss", v.Name, "episode", key)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareCandidates(t *testing.T) {
+	require.Equal(t, "SubsPlease", ParseGroup("[SubsPlease] Show - 07 (1080p)"))
+	require.Equal(t, "GRP", ParseGroup("Show.S01E07.1080p.WEB-DL.x265-GRP.mkv"))
+	require.Equal(t, "", ParseGroup("Show S01E07"))
+
+	items := []Item{
+		{Title: "[Other] Show - 07 [1080p]", Seeders: 100},
+		{Title: "[GroupB] Show - 07 [720p]", Seeders: 10},
+		{Title: "[GroupB] Show - 07 [1080p]", Seeders: 5},
+		{Title: "[GroupB] Show - 07 [1080p] (mirror)", Seeders: 50},
+	}
+
+	r := &RSS{GroupPriority: []string{"groupa", "groupb"}, Quality: &QualityPreference{Resolution: []string{"1080p", "720p"}}}
+	slices.SortStableFunc(items, r.CompareCandidates)
+	require.Equal(t, "[GroupB] Show - 07 [1080p] (mirror)", items[0].Title)
+	require.Equal(t, "[GroupB] Show - 07 [1080p]", items[1].Title)
+	require.Equal(t, "[GroupB] Show - 07 [720p]", items[2].Title)
+
+	r = &RSS{}
+	slices.SortStableFunc(items, r.CompareCandidates)
+	require.Equal(t, "[Other] Show - 07 [1080p]", items[0].Title)
+}
+
+func TestReleasePendingFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cache, err := NewCacheByPath(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer cache.Close()
+
+	j := NewJob(nil, cache)
+	f := &Feed{Rss: &RSS{Name: "hold", Url: "test://rss_url", HoldWindow: 1}, Client: http.DefaultClient}
+
+	pending := PendingEpisode{
+		FirstSeen: time.Now().Add(-time.Hour),
+		Items: []Item{
+			{Title: "[A] Show - 07 [1080p]", Url: server.URL + "/a.torrent", Seeders: 10},
+			{Title: "[B] Show - 07 [1080p]", Url: server.URL + "/b.torrent", Seeders: 5},
+		},
+	}
+	for i := range pending.Items {
+		pending.Items[i].AddLink(UrlSourceEnclosure, pending.Items[i].Url, "")
+	}
+	require.NoError(t, cache.StorePending(f.Rss.Url, "show|S01E07", pending))
+
+	j.releasePending(f)
+
+	require.Contains(t, cache.LoadPending(f.Rss.Url), "show|S01E07")
+	for _, item := range pending.Items {
+		_, ok := cache.LoadRejected(f.Rss.Url, item.Url)
+		require.False(t, ok)
+	}
+	require.Contains(t, j.FeedErrors(), "hold")
+}
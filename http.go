@@ -55,11 +55,17 @@ func route() http.Handler {
 	})
 
 	ServerHTTP(mux, "GET /api/v1/status", func(w http.ResponseWriter, r *http.Request) error {
-		return json.NewEncoder(w).Encode(map[string]any{"running": job.Running()})
+		return json.NewEncoder(w).Encode(map[string]any{"running": job.Running(), "errors": job.FeedErrors()})
 	})
 
 	ServerHTTP(mux, "GET /api/v1/config", func(w http.ResponseWriter, r *http.Request) error {
-		return json.NewEncoder(w).Encode(config.Load().Rss)
+		rss := config.Load().Rss
+		redactedRss := make([]*RSS, 0, len(rss))
+		for _, v := range rss {
+			redactedRss = append(redactedRss, v.Redacted())
+		}
+
+		return json.NewEncoder(w).Encode(redactedRss)
 	})
 
 	type UpdateRequest struct {
@@ -120,6 +126,7 @@ func route() http.Handler {
 			return errors.New("original config name not match")
 		}
 
+		req.Config.RestoreRedacted(oc)
 		cf.Rss[req.Index] = req.Config
 
 		return saveConfig(cf)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -13,9 +14,18 @@ import (
 )
 
 type Job struct {
-	tr     *Transmission
-	cache  Cache
-	runJob atomic.Bool
+	tr       *Transmission
+	cache    Cache
+	runJob   atomic.Bool
+	watchers dirWatchers
+	// feedErrors is the last error of each feed by name, it's shown in the web ui.
+	feedErrors sync.Map
+}
+
+type FeedError struct {
+	Error        string    `json:"error"`
+	AuthRequired bool      `json:"auth_required,omitempty"`
+	Time         time.Time `json:"time"`
 }
 
 func NewJob(tr *Transmission, cache Cache) *Job {
@@ -27,10 +37,31 @@ func NewJob(tr *Transmission, cache Cache) *Job {
 
 func (j *Job) Running() bool { return j.runJob.Load() }
 
+// setFeedError stores the error of the feed, the secrets are redacted as it's shown in the web ui.
+func (j *Job) setFeedError(v *RSS, err error) {
+	j.feedErrors.Store(v.Name, FeedError{
+		Error:        v.RedactError(err.Error()),
+		AuthRequired: errors.Is(err, ErrAuthRequired),
+		Time:         time.Now(),
+	})
+}
+
+// FeedErrors returns the errors of the feeds in the last run.
+func (j *Job) FeedErrors() map[string]FeedError {
+	m := make(map[string]FeedError)
+	j.feedErrors.Range(func(k, v any) bool {
+		m[k.(string)] = v.(FeedError)
+		return true
+	})
+	return m
+}
+
 func (j *Job) Start(ctx context.Context, notify chan struct{}, getConfig func() *Config, updateInterval int) error {
 	ticker := time.NewTicker(time.Minute * time.Duration(updateInterval))
 	defer ticker.Stop()
 
+	j.watchers.Sync(ctx, getConfig(), notify)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -41,6 +72,8 @@ func (j *Job) Start(ctx context.Context, notify chan struct{}, getConfig func()
 			j.Do(getConfig)
 			ticker.Reset(time.Hour)
 		}
+
+		j.watchers.Sync(ctx, getConfig(), notify)
 	}
 }
 
@@ -74,10 +107,20 @@ func (j *Job) Do(getConfig func() *Config) {
 	slog.Info("job done")
 }
 
+// Feed is a feed of a job run, with its source, http client and the client options merged with the global config.
+type Feed struct {
+	Rss     *RSS
+	Source  Source
+	Client  HTTPClient
+	Options ClientConfig
+}
+
 func (j *Job) DoOne(config *Config) {
 	type Result struct {
 		channels []Channel
-		rss      *RSS
+		feed     *Feed
+		// meta is stored after all the items are processed, nil when the feed is not modified.
+		meta *FeedMeta
 	}
 
 	ch := make(chan Result, 10)
@@ -91,11 +134,54 @@ func (j *Job) DoOne(config *Config) {
 
 			time.Sleep(time.Millisecond * time.Duration(v.FetchInterval))
 
-			ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
-			chs, err := ParseUrl(ctx, v.Url)
+			j.feedErrors.Delete(v.Name)
+
+			source, err := v.Source()
+			if err != nil {
+				slog.Error("get source failed", "err", err, "url", v.Url, "name", v.Name)
+				j.setFeedError(v, err)
+				continue
+			}
+
+			client, err := v.Client(config.ClientConfig)
+			if err != nil {
+				slog.Error("create http client failed", "err", err, "url", v.Url, "name", v.Name)
+				j.setFeedError(v, err)
+				continue
+			}
+
+			options := v.ClientConfig.Merge(config.ClientConfig)
+
+			feed := &Feed{
+				Rss:     v,
+				Source:  source,
+				Client:  client,
+				Options: options,
+			}
+
+			meta, _ := j.cache.LoadFeedMeta(v.Url)
+			if fingerprint := v.Fingerprint(); meta.Fingerprint != fingerprint {
+				// the config is changed, fetch the whole feed again for the new rules
+				meta = FeedMeta{Fingerprint: fingerprint}
+			}
+
+			timeout := 45 * time.Second
+			if v.Backfill && !meta.Backfilled {
+				timeout *= time.Duration(v.backfillPages())
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			chs, err := source.Fetch(ctx, FetchOptions{Rss: v, Client: client, Meta: &meta, MaxSize: options.maxFeedSize()})
 			cancel()
+			if errors.Is(err, ErrNotModified) {
+				slog.Info("rss not modified", "url", v.Url, "name", v.Name)
+				// the held episodes are still released
+				ch <- Result{feed: feed}
+				continue
+			}
 			if err != nil {
 				slog.Error("parse rss failed", "err", err, "url", v.Url, "name", v.Name)
+				j.setFeedError(v, err)
 				return
 			}
 
@@ -107,26 +193,62 @@ func (j *Job) DoOne(config *Config) {
 
 			ch <- Result{
 				channels: chs,
-				rss:      v,
+				feed:     feed,
+				meta:     &meta,
 			}
 		}
 	}()
 
 	for r := range ch {
 		chs := r.channels
-		v := r.rss
+		v := r.feed.Rss
 
+		failed := false
 		for _, ch := range chs {
 			for _, item := range ch.Items {
-				if err := j.Process(v, item); err != nil {
+				if err := j.Process(r.feed, item); err != nil {
 					slog.Error("process item failed", "url", item.Url, "name", v.Name, "err", err)
+					j.setFeedError(v, err)
+					failed = true
 				}
 			}
 		}
+
+		// keep the old validators when any item failed, so the whole feed is fetched and retried next time
+		if r.meta != nil && !failed {
+			if err := j.cache.StoreFeedMeta(v.Url, *r.meta); err != nil {
+				slog.Error("store feed meta failed", "err", err, "url", v.Url, "name", v.Name)
+			}
+		}
+
+		if v.HoldWindow > 0 {
+			j.releasePending(r.feed)
+		}
 	}
 }
 
-func (j *Job) Process(v *RSS, item Item) error {
+func (j *Job) Process(f *Feed, item Item) error {
+	return j.process(f, item, true)
+}
+
+// process adds the item, it's held as a candidate of its episode when hold is true and the feed has a hold window.
+func (j *Job) process(f *Feed, item Item, hold bool) error {
+	v := f.Rss
+
+	if !v.ResolveUrl(&item) {
+		return nil
+	}
+
+	v.ParsePubDate(&item)
+
+	if item.InvalidPubDate {
+		slog.Warn("invalid pub date", "url", item.Url, "name", item.Title, "date", item.RawPubDate, "rss", v.Name)
+
+		if v.DownloadAfter != 0 {
+			return nil
+		}
+	}
+
 	if !v.MatchDate(item.PubDate) {
 		return nil
 	}
@@ -135,34 +257,127 @@ func (j *Job) Process(v *RSS, item Item) error {
 		return nil
 	}
 
+	if !v.MatchAttr(item) {
+		return nil
+	}
+
 	_, ok := j.cache.Load(v.Url, item.Url)
 	if ok {
+		return j.commit(f, item)
+	}
+
+	if _, ok := j.cache.LoadRejected(v.Url, item.Url); ok {
 		return nil
 	}
 
+	if item.InfoHash != "" {
+		if _, ok := j.cache.LoadInfoHash(v.Url, item.InfoHash); ok {
+			slog.Info("skip duplicate infohash", "url", item.Url, "name", item.Title, "infohash", item.InfoHash)
+			return j.commit(f, item)
+		}
+
+		if j.crossFeedDuplicate(v, item, item.InfoHash) {
+			return j.cache.StoreInfoHash(v.Url, item.InfoHash, item.Url)
+		}
+	}
+
+	episode, parsed := ParseEpisode(item.Title)
+	// the episodes are only recorded when they're tracked or the replaced releases are removed
+	tracked := parsed && (v.TrackEpisodes || v.RemoveOld)
+
+	var replaced []EpisodeRecord
+	if tracked {
+		if records, ok := j.episodeRecords(v, episode); ok {
+			switch {
+			case v.Revises(item, episode, records):
+				slog.Info("replace episode with revision", "url", item.Url, "name", item.Title, "episode", episode)
+				replaced = records
+			case !v.TrackEpisodes:
+			case v.CanUpgrade(item, records):
+				replaced = records
+			default:
+				slog.Info("skip obtained episode", "url", item.Url, "name", item.Title, "episode", episode)
+				return nil
+			}
+		}
+	}
+
+	if hold && parsed && v.HoldWindow > 0 {
+		return j.hold(v, episode, item)
+	}
+
 	if v.FetchInterval > 0 {
 		time.Sleep(time.Duration(v.FetchInterval) * time.Millisecond)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
-	tr, err := item.Get(ctx)
+	tr, err := item.Get(ctx, f.Client, f.Options.maxTorrentSize(), isLocalSource(f.Source))
 	cancel()
 	if err != nil {
 		return fmt.Errorf("get torrent failed: %w", err)
 	}
 
+	if err := v.Validate(tr, item); err != nil {
+		if serr := j.cache.StoreRejected(v.Url, item.Url, err.Error()); serr != nil {
+			slog.Error("store rejected torrent failed", "err", serr, "url", item.Url, "name", item.Title)
+		}
+		return err
+	}
+
+	if item.InfoHash == "" && j.crossFeedDuplicate(v, item, tr.InfoHash()) {
+		if err := j.cache.Store(v.Url, item.Url, tr); err != nil {
+			return fmt.Errorf("store torrent failed: %w", err)
+		}
+		return j.cache.StoreInfoHash(v.Url, tr.InfoHash(), item.Url)
+	}
+
 	err = j.tr.Add(context.TODO(), tr, v.DownloadDir, v.Label)
 	if err != nil {
 		return fmt.Errorf("add torrent failed: %w", err)
 	}
 
-	slog.Info("add torrent", "url", item.Url, "name", item.Title)
+	slog.Info("add torrent", "url", item.Url, "name", item.Title, "infohash", tr.InfoHash())
 
 	err = j.cache.Store(v.Url, item.Url, tr)
 	if err != nil {
 		return fmt.Errorf("store torrent failed: %w", err)
 	}
 
+	infoHash := tr.InfoHash()
+	if infoHash == "" {
+		infoHash = item.InfoHash
+	}
+
+	if infoHash != "" {
+		err = j.cache.StoreInfoHash(v.Url, infoHash, item.Url)
+		if err != nil {
+			return fmt.Errorf("store infohash failed: %w", err)
+		}
+	}
+
+	if tracked {
+		record := EpisodeRecord{Title: item.Title, TorrentUrl: item.Url, InfoHash: infoHash, Added: time.Now()}
+		if err := j.cache.StoreEpisodes(v.Url, episode.Keys(), record); err != nil {
+			return fmt.Errorf("store episode failed: %w", err)
+		}
+	}
+
+	if v.RemoveOld {
+		j.removeReplaced(v, replaced, infoHash)
+	}
+
+	return j.commit(f, item)
+}
+
+// commit tells the source the item is added, it's also called for the items already added,
+// so the duplicate files of the watch directories are moved aside too.
+func (j *Job) commit(f *Feed, item Item) error {
+	if committer, ok := f.Source.(SourceCommitter); ok {
+		if err := committer.Commit(f.Rss, item); err != nil {
+			return fmt.Errorf("commit item failed: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -181,7 +396,7 @@ func splitConfigByHostname(config *Config) map[string]*Config {
 
 		x := m[uri.Host]
 		if x == nil {
-			x = new(Config)
+			x = &Config{ClientConfig: config.ClientConfig}
 			m[uri.Host] = x
 		}
 
@@ -189,3 +404,56 @@ func splitConfigByHostname(config *Config) map[string]*Config {
 	}
 	return m
 }
+
+// episodeRecords returns the records of the episodes of the release,
+// ok is false unless all of them are already added by the feed.
+func (j *Job) episodeRecords(v *RSS, episode Episode) ([]EpisodeRecord, bool) {
+	keys := episode.Keys()
+	records := make([]EpisodeRecord, 0, len(keys))
+	for _, key := range keys {
+		record, ok := j.cache.LoadEpisode(v.Url, key)
+		if !ok {
+			return nil, false
+		}
+		records = append(records, record)
+	}
+	return records, true
+}
+
+// removeReplaced removes the torrents of the replaced releases, the failures are only logged.
+func (j *Job) removeReplaced(v *RSS, replaced []EpisodeRecord, infoHash string) {
+	removed := map[string]bool{infoHash: true, "": true}
+	for _, record := range replaced {
+		if removed[record.InfoHash] {
+			continue
+		}
+		removed[record.InfoHash] = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := j.tr.Remove(ctx, record.InfoHash, v.RemoveOldData)
+		cancel()
+		if err != nil {
+			slog.Error("remove replaced torrent failed", "err", err, "rss", v.Name, "name", record.Title, "infohash", record.InfoHash)
+			continue
+		}
+
+		slog.Info("remove replaced torrent", "rss", v.Name, "name", record.Title, "infohash", record.InfoHash)
+	}
+}
+
+// crossFeedDuplicate reports whether the infohash is already added by any feed,
+// it's skipped when the feed disables dedup_across_feeds.
+func (j *Job) crossFeedDuplicate(v *RSS, item Item, infoHash string) bool {
+	if (v.DedupAcrossFeeds != nil && !*v.DedupAcrossFeeds) || infoHash == "" {
+		return false
+	}
+
+	rssUrl, torrentUrl, ok := j.cache.LookupInfoHash(infoHash)
+	if !ok {
+		return false
+	}
+
+	slog.Info("skip duplicate infohash of other feed", "url", item.Url, "name", item.Title,
+		"infohash", infoHash, "rss", rssUrl, "torrent", torrentUrl)
+	return true
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrossFeedDuplicate(t *testing.T) {
+	cache, err := NewCacheByPath(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer cache.Close()
+
+	require.NoError(t, cache.StoreInfoHash("test://rss_url", "abcdef", "test://torrent_url"))
+
+	j := NewJob(nil, cache)
+	item := Item{Title: "mirror", Url: "test://mirror_url"}
+
+	require.True(t, j.crossFeedDuplicate(&RSS{Url: "test://rss_url_2"}, item, "abcdef"))
+	require.False(t, j.crossFeedDuplicate(&RSS{Url: "test://rss_url_2"}, item, "fedcba"))
+
+	disabled := false
+	require.False(t, j.crossFeedDuplicate(&RSS{Url: "test://rss_url_2", DedupAcrossFeeds: &disabled}, item, "abcdef"))
+}
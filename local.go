@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Asutorufa/transmission-rss/watch"
+)
+
+const (
+	SourceTypeFile = "file"
+	SourceTypeDir  = "dir"
+)
+
+// processedDir is the sub directory of a watch directory that added files are moved to.
+const processedDir = "processed"
+
+// localPath returns the path of a file:// url, or the url itself if it's a plain path.
+func localPath(s string) (string, error) {
+	if !strings.HasPrefix(s, "file://") {
+		return s, nil
+	}
+
+	uri, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	return uri.Host + uri.Path, nil
+}
+
+func fileUrl(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// fileSource reads a RSS, Atom or JSON Feed document from disk.
+type fileSource struct{}
+
+func (fileSource) Local() bool { return true }
+
+func (fileSource) Fetch(ctx context.Context, opts FetchOptions) ([]Channel, error) {
+	path, err := localPath(opts.Rss.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseReader(newLimitedReader(f, opts.MaxSize))
+}
+
+// dirSource picks up the .torrent and .magnet files in a directory as items,
+// the added files are moved to the processed sub directory.
+type dirSource struct{}
+
+func (dirSource) Local() bool { return true }
+
+func (dirSource) Fetch(ctx context.Context, opts FetchOptions) ([]Channel, error) {
+	dir, err := localPath(opts.Rss.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := Channel{
+		Title: filepath.Base(dir),
+		Url:   fileUrl(dir),
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		it := Item{
+			Title:   strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())),
+			GUID:    fileUrl(path),
+			PubDate: info.ModTime(),
+		}
+
+		switch ext {
+		case ".torrent":
+			// the url is also the cache key, the mtime keeps a new file with the same name from being skipped
+			it.AddLink(UrlSourceEnclosure, fileUrl(path)+"?mtime="+strconv.FormatInt(info.ModTime().UnixNano(), 10), "application/x-bittorrent")
+		case ".magnet":
+			data, err := os.ReadFile(path)
+			if err != nil {
+				slog.Error("read magnet file failed", "err", err, "path", path)
+				continue
+			}
+
+			magnet := strings.TrimSpace(string(data))
+			if !strings.HasPrefix(magnet, "magnet:?") {
+				slog.Error("invalid magnet file", "path", path)
+				continue
+			}
+
+			it.AddLink(UrlSourceMagnet, magnet, "")
+		default:
+			continue
+		}
+
+		it.ResolveUrl(nil, false)
+
+		ch.Items = append(ch.Items, it)
+	}
+
+	return []Channel{ch}, nil
+}
+
+// Commit moves the added file to the processed sub directory.
+func (dirSource) Commit(rss *RSS, item Item) error {
+	path, err := localPath(item.GUID)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(filepath.Dir(path), processedDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(path, filepath.Join(dir, filepath.Base(path)))
+}
+
+// dirWatchers runs the job when the watch directories changed.
+type dirWatchers struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// Sync starts the watchers of new watch directories and stops the removed ones.
+func (d *dirWatchers) Sync(ctx context.Context, config *Config, notify chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancels == nil {
+		d.cancels = make(map[string]context.CancelFunc)
+	}
+
+	dirs := make(map[string]bool)
+	for _, v := range config.Rss {
+		if v.Type != SourceTypeDir || v.ExpiredOrDisabled() {
+			continue
+		}
+
+		dir, err := localPath(v.Url)
+		if err != nil {
+			continue
+		}
+
+		dirs[dir] = true
+	}
+
+	for dir, cancel := range d.cancels {
+		if !dirs[dir] {
+			cancel()
+			delete(d.cancels, dir)
+		}
+	}
+
+	for dir := range dirs {
+		if _, ok := d.cancels[dir]; ok {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		d.cancels[dir] = cancel
+
+		go func() {
+			err := watch.WatchDir(ctx, dir, func() {
+				slog.Info("watch directory changed, start job", "dir", dir)
+				select {
+				case notify <- struct{}{}:
+				case <-ctx.Done():
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				slog.Error("watch directory failed", "err", err, "dir", dir)
+			}
+
+			d.mu.Lock()
+			if ctx.Err() == nil {
+				delete(d.cancels, dir)
+			}
+			d.mu.Unlock()
+		}()
+	}
+}
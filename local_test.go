@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalSource(t *testing.T) {
+	dir := t.TempDir()
+
+	feed := filepath.Join(dir, "feed.xml")
+	require.NoError(t, os.WriteFile(feed, []byte(`<rss version="2.0"><channel><title>file</title></channel></rss>`), 0644))
+
+	r := &RSS{Url: fileUrl(feed)}
+	source, err := r.Source()
+	require.NoError(t, err)
+	chs, err := source.Fetch(context.Background(), FetchOptions{Rss: r})
+	require.NoError(t, err)
+	require.Equal(t, "file", chs[0].Title)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.torrent"), testTorrent("a", map[string]int64{"a.mkv": 1024}), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.magnet"), []byte("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567\n"), 0644))
+
+	r = &RSS{Type: SourceTypeDir, Url: dir}
+	source, err = r.Source()
+	require.NoError(t, err)
+	chs, err = source.Fetch(context.Background(), FetchOptions{Rss: r})
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 2)
+
+	item := chs[0].Items[0]
+	require.Equal(t, "a", item.Title)
+
+	_, err = item.Get(context.Background(), http.DefaultClient, 0, false)
+	require.ErrorIs(t, err, ErrLocalUrl)
+	require.True(t, isLocalSource(source))
+
+	tr, err := item.Get(context.Background(), http.DefaultClient, 0, true)
+	require.NoError(t, err)
+	require.Equal(t, "a.mkv", tr.(*TorrentFile).Torrent.Files[0].Path[1])
+
+	require.Equal(t, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", chs[0].Items[1].Url)
+
+	require.NoError(t, source.(SourceCommitter).Commit(r, item))
+	require.FileExists(t, filepath.Join(dir, processedDir, "a.torrent"))
+
+	chs, err = source.Fetch(context.Background(), FetchOptions{Rss: r})
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 1)
+
+	cache, err := NewCacheByPath(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer cache.Close()
+
+	// a magnet already added is moved aside without adding
+	j := NewJob(nil, cache)
+	magnet := chs[0].Items[0]
+	require.NoError(t, cache.Store(r.Url, magnet.Url, TorrentHash(magnet.Url)))
+	require.NoError(t, j.Process(&Feed{Rss: r, Source: source}, magnet))
+	require.FileExists(t, filepath.Join(dir, processedDir, "b.magnet"))
+
+	// a new file with the name of an added one is a new item
+	require.NoError(t, cache.Store(r.Url, item.Url, tr))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.torrent"), testTorrent("a2", map[string]int64{"a.mkv": 1024}), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "a.torrent"), time.Now(), time.Now().Add(time.Minute)))
+
+	chs, err = source.Fetch(context.Background(), FetchOptions{Rss: r})
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 1)
+	require.NotEqual(t, item.Url, chs[0].Items[0].Url)
+
+	_, ok := cache.Load(r.Url, chs[0].Items[0].Url)
+	require.False(t, ok)
+}
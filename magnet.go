@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidMagnet = errors.New("invalid magnet link")
+
+// Magnet is the parsed magnet link, InfoHash is always the lowercase hex of the v1 btih.
+type Magnet struct {
+	InfoHash string
+	Name     string
+	Trackers []string
+}
+
+func ParseMagnet(s string) (Magnet, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return Magnet{}, err
+	}
+
+	if u.Scheme != "magnet" {
+		return Magnet{}, ErrInvalidMagnet
+	}
+
+	query := u.Query()
+
+	var m Magnet
+	for _, xt := range query["xt"] {
+		if hash, ok := strings.CutPrefix(strings.ToLower(xt), "urn:btih:"); ok {
+			m.InfoHash = NormalizeInfoHash(xt[len(xt)-len(hash):])
+			break
+		}
+	}
+
+	if m.InfoHash == "" {
+		return Magnet{}, ErrInvalidMagnet
+	}
+
+	m.Name = query.Get("dn")
+	m.Trackers = query["tr"]
+
+	return m, nil
+}
+
+// NormalizeInfoHash converts the hex or base32 infohash to lowercase hex,
+// an empty string is returned when it's neither.
+func NormalizeInfoHash(s string) string {
+	s = strings.TrimSpace(s)
+
+	switch len(s) {
+	case 40:
+		if _, err := hex.DecodeString(s); err == nil {
+			return strings.ToLower(s)
+		}
+	case 32:
+		if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(s)); err == nil {
+			return hex.EncodeToString(b)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMagnet(t *testing.T) {
+	m, err := ParseMagnet("magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH&dn=%5BGroup%5D+Show+-+07&tr=udp%3A%2F%2Fa%3A80&tr=http%3A%2F%2Fb%2Fannounce")
+	require.NoError(t, err)
+	require.Equal(t, "0123456789abcdef0123456789abcdef01234567", m.InfoHash)
+	require.Equal(t, "[Group] Show - 07", m.Name)
+	require.Equal(t, []string{"udp://a:80", "http://b/announce"}, m.Trackers)
+
+	m, err = ParseMagnet("magnet:?dn=a&xt=urn:btih:0123456789ABCDEF0123456789ABCDEF01234567")
+	require.NoError(t, err)
+	require.Equal(t, "0123456789abcdef0123456789abcdef01234567", m.InfoHash)
+
+	_, err = ParseMagnet("magnet:?xt=urn:btih:xyz")
+	require.ErrorIs(t, err, ErrInvalidMagnet)
+	_, err = ParseMagnet("https://example.com/a.torrent")
+	require.ErrorIs(t, err, ErrInvalidMagnet)
+
+	tf, err := ParseTorrent(testTorrent("a", map[string]int64{"a.mkv": 1}))
+	require.NoError(t, err)
+	require.Len(t, tf.InfoHash(), 40)
+	require.Equal(t, tf.InfoHash(), TorrentHash(magnetFromInfoHash(tf.InfoHash(), "a")).InfoHash())
+
+	it := Item{}
+	it.AddLink(UrlSourceMagnet, "magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH", "")
+	require.True(t, it.ResolveUrl(nil, false))
+	require.Equal(t, "0123456789abcdef0123456789abcdef01234567", it.InfoHash)
+}
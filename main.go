@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	_ "time/tzdata"
 
 	"github.com/BurntSushi/toml"
 )
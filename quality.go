@@ -0,0 +1,120 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Quality is the release quality parsed from the title, the values are normalized
+// like "1080p", "hevc" and "webdl", empty when it's unknown.
+type Quality struct {
+	Resolution string
+	Codec      string
+	Source     string
+}
+
+type qualityTerm struct {
+	re    *regexp.Regexp
+	value string
+}
+
+var (
+	resolutionTerms = []qualityTerm{
+		{regexp.MustCompile(`(?i)\b(?:2160p|4k|uhd|3840x2160)\b`), "2160p"},
+		{regexp.MustCompile(`(?i)\b(?:1080[pi]|1920x1080)\b`), "1080p"},
+		{regexp.MustCompile(`(?i)\b(?:720p|1280x720)\b`), "720p"},
+		{regexp.MustCompile(`(?i)\b(?:576p|480p)\b`), "480p"},
+	}
+	codecTerms = []qualityTerm{
+		{regexp.MustCompile(`(?i)\b(?:av1)\b`), "av1"},
+		{regexp.MustCompile(`(?i)\b(?:hevc|[xh]\.?265)\b`), "hevc"},
+		{regexp.MustCompile(`(?i)\b(?:avc|[xh]\.?264)\b`), "avc"},
+	}
+	sourceTerms = []qualityTerm{
+		{regexp.MustCompile(`(?i)\b(?:remux)\b`), "remux"},
+		{regexp.MustCompile(`(?i)\b(?:blu-?ray|bdrip|bd)\b`), "bluray"},
+		{regexp.MustCompile(`(?i)\bweb[ .-]?dl\b`), "webdl"},
+		{regexp.MustCompile(`(?i)\bweb[ .-]?rip\b`), "webrip"},
+		{regexp.MustCompile(`(?i)\bhdtv\b`), "hdtv"},
+	}
+)
+
+func matchQualityTerm(terms []qualityTerm, s string) string {
+	for _, t := range terms {
+		if t.re.MatchString(s) {
+			return t.value
+		}
+	}
+	return ""
+}
+
+func ParseQuality(title string) Quality {
+	return Quality{
+		Resolution: matchQualityTerm(resolutionTerms, title),
+		Codec:      matchQualityTerm(codecTerms, title),
+		Source:     matchQualityTerm(sourceTerms, title),
+	}
+}
+
+// QualityPreference ranks the qualities, each list is ordered from best to worst
+// and compared in order of resolution, codec and source.
+type QualityPreference struct {
+	Resolution []string `json:"resolution,omitempty" toml:"resolution"`
+	Codec      []string `json:"codec,omitempty" toml:"codec"`
+	Source     []string `json:"source,omitempty" toml:"source"`
+}
+
+// rank returns the position of the value in the preference, the unlisted values rank last.
+func rank(terms []qualityTerm, preference []string, value string) int {
+	if value == "" {
+		return len(preference)
+	}
+
+	for i, v := range preference {
+		normalized := matchQualityTerm(terms, v)
+		if normalized == "" {
+			normalized = strings.ToLower(v)
+		}
+
+		if normalized == value {
+			return i
+		}
+	}
+	return len(preference)
+}
+
+func (p *QualityPreference) rank(q Quality) []int {
+	return []int{
+		rank(resolutionTerms, p.Resolution, q.Resolution),
+		rank(codecTerms, p.Codec, q.Codec),
+		rank(sourceTerms, p.Source, q.Source),
+	}
+}
+
+// Compare returns -1 if a is better than b, 1 if b is better, 0 if they rank the same.
+func (p *QualityPreference) Compare(a, b Quality) int {
+	return slices.Compare(p.rank(a), p.rank(b))
+}
+
+// CanUpgrade reports whether the item may be added again for the episodes already obtained,
+// it must be within the upgrade window, and with a quality preference rank better than all of them.
+func (r *RSS) CanUpgrade(item Item, records []EpisodeRecord) bool {
+	if !r.AllowUpgrades {
+		return false
+	}
+
+	quality := ParseQuality(item.Title)
+	for _, record := range records {
+		if r.UpgradeWindow > 0 && time.Since(record.Added) > time.Duration(r.UpgradeWindow)*time.Minute {
+			return false
+		}
+
+		if r.Quality != nil && r.Quality.Compare(quality, ParseQuality(record.Title)) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
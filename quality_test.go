@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQualityUpgrade(t *testing.T) {
+	require.Equal(t, Quality{Resolution: "1080p", Codec: "hevc", Source: "webdl"}, ParseQuality("Show.S01E07.1080p.WEB-DL.x265-GRP"))
+	require.Equal(t, Quality{Resolution: "720p", Codec: "avc", Source: "bluray"}, ParseQuality("[Group] Show - 07 [BD 720p AVC]"))
+	require.Equal(t, Quality{}, ParseQuality("[Group] Show - 07"))
+
+	p := &QualityPreference{Resolution: []string{"1080p", "720p"}, Codec: []string{"x265", "x264"}, Source: []string{"WEB-DL", "WEBRip"}}
+	require.Equal(t, -1, p.Compare(ParseQuality("1080p WEBRip x264"), ParseQuality("720p WEB-DL x265")))
+	require.Equal(t, -1, p.Compare(ParseQuality("1080p WEBRip x265"), ParseQuality("1080p WEB-DL x264")))
+	require.Equal(t, 1, p.Compare(ParseQuality("1080p WEBRip"), ParseQuality("1080p WEB-DL")))
+	require.Equal(t, 1, p.Compare(ParseQuality("unknown"), ParseQuality("720p")))
+	require.Equal(t, 0, p.Compare(ParseQuality("2160p"), ParseQuality("unknown")))
+
+	records := []EpisodeRecord{{Title: "Show S01E07 720p WEB-DL", Added: time.Now().Add(-time.Hour)}}
+	better := Item{Title: "Show S01E07 1080p WEB-DL"}
+
+	r := &RSS{}
+	require.False(t, r.CanUpgrade(better, records))
+
+	r = &RSS{AllowUpgrades: true}
+	require.True(t, r.CanUpgrade(Item{Title: "Show S01E07 480p"}, records))
+
+	r = &RSS{AllowUpgrades: true, Quality: p}
+	require.True(t, r.CanUpgrade(better, records))
+	require.False(t, r.CanUpgrade(Item{Title: "Show S01E07 720p WEBRip"}, records))
+	require.False(t, r.CanUpgrade(Item{Title: "Show S01E07 720p WEB-DL"}, records))
+
+	r = &RSS{AllowUpgrades: true, Quality: p, UpgradeWindow: 30}
+	require.False(t, r.CanUpgrade(better, records))
+
+	r = &RSS{AllowUpgrades: true, UpgradeWindow: 30}
+	require.False(t, r.CanUpgrade(better, records))
+	require.True(t, r.CanUpgrade(better, []EpisodeRecord{{Title: "Show S01E07 720p WEB-DL", Added: time.Now()}}))
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
 )
 
 /*
@@ -19,9 +28,98 @@ https://planet.openstreetmap.org/planet/changesets-bz2-rss.xml
 https://planet.openstreetmap.org/planet/discussions-bz2-rss.xml
 */
 
+// ParseString parses a RSS 2.0, Atom or JSON Feed document,
+// non UTF-8 xml documents are decoded by the encoding of the xml declaration.
 func ParseString(data string) ([]Channel, error) {
+	return ParseReader(strings.NewReader(data))
+}
+
+// ParseReader is like ParseString, but decodes the document from a stream.
+func ParseReader(r io.Reader) ([]Channel, error) {
+	return parseDocument(r, charsetReader)
+}
+
+type charsetReaderFunc func(label string, input io.Reader) (io.Reader, error)
+
+// charsetReader decodes the input to UTF-8 by the charset label, like GBK, Big5, Shift_JIS or EUC-JP.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q: %w", label, err)
+	}
+
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// utf8Reader ignores the encoding of the xml declaration, used when the data is already decoded.
+func utf8Reader(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+
+func parseDocument(r io.Reader, cr charsetReaderFunc) ([]Channel, error) {
+	br := bufio.NewReader(r)
+
+	if isJSON(br) {
+		return parseJSONFeed(br)
+	}
+
+	decoder := xml.NewDecoder(br)
+	decoder.CharsetReader = cr
+
+	root, err := rootElement(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	switch root.Name.Local {
+	case "rss":
+		return parseRSS(decoder, root)
+	case "feed":
+		return parseAtom(decoder, root)
+	default:
+		return nil, fmt.Errorf("unsupported feed type: %s", root.Name.Local)
+	}
+}
+
+// isJSON peeks the first non space byte of the stream.
+func isJSON(br *bufio.Reader) bool {
+	for n := 1; n <= br.Size(); n++ {
+		b, err := br.Peek(n)
+		if err != nil {
+			return false
+		}
+
+		switch b[n-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return true
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// rootElement reads the decoder to the first element of a xml document.
+func rootElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return xml.StartElement{}, errors.New("empty xml document")
+			}
+			return xml.StartElement{}, err
+		}
+
+		if se, ok := token.(xml.StartElement); ok {
+			return se, nil
+		}
+	}
+}
+
+func parseRSS(decoder *xml.Decoder, root xml.StartElement) ([]Channel, error) {
 	var rf RSSFeed
-	err := xml.Unmarshal([]byte(data), &rf)
+	err := decoder.DecodeElement(&rf, &root)
 	if err != nil {
 		return nil, err
 	}
@@ -33,24 +131,58 @@ func ParseString(data string) ([]Channel, error) {
 			Title:    channel.Title,
 			Url:      channel.Link,
 			Describe: channel.Description,
+			Next:     channel.AtomLinks.Href("next"),
+		}
+
+		if r := channel.Response; r.Total > 0 && len(channel.Items) > 0 && r.Offset+len(channel.Items) < r.Total {
+			ch.NextOffset = r.Offset + len(channel.Items)
 		}
 
 		for _, item := range channel.Items {
-			if len(item.Enclosure) == 0 {
-				continue
+			it := Item{
+				Title:    item.Title,
+				Describe: item.Description,
+				GUID:     item.GUID.Value,
 			}
 
-			it := Item{
-				Title:       item.Title,
-				ContentType: item.Enclosure[0].Type,
-				Url:         item.Enclosure[0].URL,
-				Describe:    item.Description,
+			it.parseTorznabAttrs(item.Attrs)
+			it.parseNyaa(item)
+
+			if it.InfoHash == "" && item.Torrent.InfoHash != "" {
+				it.InfoHash = NormalizeInfoHash(item.Torrent.InfoHash)
 			}
 
+			if it.Size == 0 && item.Torrent.ContentLength != "" {
+				it.Size, _ = strconv.ParseInt(item.Torrent.ContentLength, 10, 64)
+			}
+
+			if len(item.Enclosure) != 0 {
+				it.AddLink(UrlSourceEnclosure, item.Enclosure[0].URL, item.Enclosure[0].Type)
+
+				if it.Size == 0 {
+					it.Size = item.Enclosure[0].Len
+				}
+			}
+			it.AddLink(UrlSourceTorrent, item.Torrent.Link, "application/x-bittorrent")
+			it.AddLink(UrlSourceMagnet, it.MagnetUrl, "")
+			it.AddLink(UrlSourceMagnet, item.MagnetURI, "")
+			it.AddLink(UrlSourceMagnet, item.Torrent.MagnetURI, "")
+			if it.InfoHash != "" {
+				it.AddLink(UrlSourceMagnet, magnetFromInfoHash(it.InfoHash, it.Title), "")
+			}
+			it.AddLink(UrlSourceLink, item.Link, "")
+			it.AddLink(UrlSourceGUID, item.GUID.Value, "")
+
+			if len(it.Links) == 0 {
+				continue
+			}
+
+			it.ResolveUrl(nil, false)
+
 			if item.PubDate != "" {
-				it.PubDate = ParseTime(item.PubDate)
+				it.SetPubDate(item.PubDate)
 			} else if item.Torrent.PubDate != "" {
-				it.PubDate = ParseTime(item.Torrent.PubDate)
+				it.SetPubDate(item.Torrent.PubDate)
 			}
 
 			ch.Items = append(ch.Items, it)
@@ -62,32 +194,195 @@ func ParseString(data string) ([]Channel, error) {
 	return chs, nil
 }
 
-func ParseUrl(ctx context.Context, url string) ([]Channel, error) {
+func parseAtom(decoder *xml.Decoder, root xml.StartElement) ([]Channel, error) {
+	var af AtomFeed
+	err := decoder.DecodeElement(&af, &root)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := Channel{
+		Title:    af.Title,
+		Url:      af.Links.Href("alternate"),
+		Describe: af.Subtitle,
+		Next:     af.Links.Href("next"),
+	}
+
+	for _, entry := range af.Entries {
+		it := Item{
+			Title:    entry.Title,
+			Describe: entry.Summary,
+			GUID:     entry.ID,
+		}
+
+		if enclosure, ok := entry.Links.Find("enclosure"); ok {
+			it.AddLink(UrlSourceEnclosure, enclosure.Href, enclosure.Type)
+			it.Size = enclosure.Length
+		}
+		it.AddLink(UrlSourceLink, entry.Links.Href("alternate"), "")
+		it.AddLink(UrlSourceGUID, entry.ID, "")
+
+		if len(it.Links) == 0 {
+			continue
+		}
+
+		it.ResolveUrl(nil, false)
+
+		if it.Describe == "" {
+			it.Describe = entry.Content
+		}
+
+		if entry.Published != "" {
+			it.SetPubDate(entry.Published)
+		} else if entry.Updated != "" {
+			it.SetPubDate(entry.Updated)
+		}
+
+		ch.Items = append(ch.Items, it)
+	}
+
+	return []Channel{ch}, nil
+}
+
+func parseJSONFeed(r io.Reader) ([]Channel, error) {
+	var jf JSONFeed
+	err := json.NewDecoder(r).Decode(&jf)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(jf.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("unsupported json feed version: %s", jf.Version)
+	}
+
+	ch := Channel{
+		Title:    jf.Title,
+		Url:      jf.HomePageUrl,
+		Describe: jf.Description,
+		Next:     jf.NextUrl,
+	}
+
+	for _, item := range jf.Items {
+		it := Item{
+			Title:    item.Title,
+			Describe: item.Summary,
+			GUID:     item.ID,
+		}
+
+		if len(item.Attachments) != 0 {
+			it.AddLink(UrlSourceEnclosure, item.Attachments[0].Url, item.Attachments[0].MimeType)
+			it.Size = item.Attachments[0].SizeInBytes
+
+			if it.Title == "" {
+				it.Title = item.Attachments[0].Title
+			}
+		}
+		it.AddLink(UrlSourceLink, item.Url, "")
+		it.AddLink(UrlSourceGUID, item.ID, "")
+
+		if len(it.Links) == 0 {
+			continue
+		}
+
+		it.ResolveUrl(nil, false)
+
+		if it.Describe == "" {
+			it.Describe = item.ContentText
+		}
+
+		if item.DatePublished != "" {
+			it.SetPubDate(item.DatePublished)
+		} else if item.DateModified != "" {
+			it.SetPubDate(item.DateModified)
+		}
+
+		ch.Items = append(ch.Items, it)
+	}
+
+	return []Channel{ch}, nil
+}
+
+// parseContent parses the feed by the Content-Type of response, falls back to sniffing the body.
+// The charset of Content-Type takes precedence over the encoding of the xml declaration.
+func parseContent(contentType string, r io.Reader) ([]Channel, error) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	cr := charsetReaderFunc(charsetReader)
+	if label := params["charset"]; label != "" {
+		decoded, err := charsetReader(label, r)
+		if err != nil {
+			return nil, err
+		}
+
+		r = decoded
+		cr = utf8Reader
+	}
+
+	switch mediaType {
+	case "application/feed+json", "application/json":
+		return parseJSONFeed(r)
+	default:
+		return parseDocument(r, cr)
+	}
+}
+
+// ErrNotModified is returned by ParseUrl when the feed responds 304 to a conditional request.
+var ErrNotModified = errors.New("feed not modified")
+
+// FeedMeta is the validators of the last feed response, used for conditional requests.
+type FeedMeta struct {
+	ETag         string
+	LastModified string
+	// Backfilled is set when the backfill of the feed is done.
+	Backfilled bool
+	// Fingerprint is the RSS.Fingerprint of the config, the meta is reset when it's changed.
+	Fingerprint string
+}
+
+// ParseUrl fetches and parses the feed, if meta is not nil, the request is sent with
+// If-None-Match/If-Modified-Since and meta is updated from the response.
+// The body larger than maxSize is rejected, zero means no limit.
+func ParseUrl(ctx context.Context, client HTTPClient, url string, meta *FeedMeta, maxSize int64) ([]Channel, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	// if f.AuthConfig != nil && f.AuthConfig.Username != "" && f.AuthConfig.Password != "" {
-	// 	req.SetBasicAuth(f.AuthConfig.Username, f.AuthConfig.Password)
-	// }
+	if meta != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	chs, err := parseContent(resp.Header.Get("Content-Type"), newLimitedReader(resp.Body, maxSize))
 	if err != nil {
 		return nil, err
 	}
 
-	return ParseString(string(data))
+	if meta != nil {
+		meta.ETag = resp.Header.Get("ETag")
+		meta.LastModified = resp.Header.Get("Last-Modified")
+	}
+
+	return chs, nil
 }
 
 type RSSFeed struct {
@@ -96,7 +391,9 @@ type RSSFeed struct {
 }
 
 type RssFeedChannel struct {
-	Title       string    `xml:"title"`
+	Title string `xml:"title"`
+	// AtomLinks must be before Link, so atom:link elements don't overwrite the link of the channel.
+	AtomLinks   AtomLinks `xml:"http://www.w3.org/2005/Atom link"`
 	Link        string    `xml:"link"`
 	Description string    `xml:"description"`
 	Language    string    `xml:"language"`
@@ -104,6 +401,11 @@ type RssFeedChannel struct {
 	PubDate     string    `xml:"pubDate"`
 	Generator   string    `xml:"generator"`
 	Items       []RSSItem `xml:"item"`
+	// Response is the newznab:response element of torznab feeds.
+	Response struct {
+		Offset int `xml:"offset,attr"`
+		Total  int `xml:"total,attr"`
+	} `xml:"response"`
 }
 
 type RSSItem struct {
@@ -131,7 +433,167 @@ type RSSItem struct {
 		Link          string `xml:"link"`
 		PubDate       string `xml:"pubDate"`
 		ContentLength string `xml:"contentLength"`
+		InfoHash      string `xml:"infoHash"`
+		MagnetURI     string `xml:"magnetURI"`
 	} `xml:"torrent"`
+	MagnetURI string        `xml:"magnetURI"`
+	Attrs     []TorznabAttr `xml:"attr"`
+
+	// nyaa namespace
+	Seeders    string `xml:"seeders"`
+	Leechers   string `xml:"leechers"`
+	InfoHash   string `xml:"infoHash"`
+	CategoryID string `xml:"categoryId"`
+	Size       string `xml:"size"`
+	Trusted    string `xml:"trusted"`
+	Remake     string `xml:"remake"`
+}
+
+// TorznabAttr is the torznab:attr or newznab:attr element of Jackett/Prowlarr feeds.
+type TorznabAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func (i *Item) parseTorznabAttrs(attrs []TorznabAttr) {
+	for _, attr := range attrs {
+		switch strings.ToLower(attr.Name) {
+		case "seeders":
+			i.Seeders, _ = strconv.Atoi(attr.Value)
+			i.HasSeeders = true
+		case "peers":
+			i.Peers, _ = strconv.Atoi(attr.Value)
+		case "size":
+			i.Size, _ = strconv.ParseInt(attr.Value, 10, 64)
+		case "infohash":
+			i.InfoHash = NormalizeInfoHash(attr.Value)
+		case "magneturl":
+			i.MagnetUrl = attr.Value
+		case "category":
+			i.Categories = append(i.Categories, attr.Value)
+		}
+	}
+}
+
+func (i *Item) parseNyaa(item RSSItem) {
+	if item.Seeders != "" {
+		i.Seeders, _ = strconv.Atoi(item.Seeders)
+		i.HasSeeders = true
+	}
+
+	if item.Leechers != "" {
+		leechers, _ := strconv.Atoi(item.Leechers)
+		i.Peers = i.Seeders + leechers
+	}
+
+	if item.InfoHash != "" {
+		i.InfoHash = NormalizeInfoHash(item.InfoHash)
+	}
+
+	if item.CategoryID != "" {
+		i.Categories = append(i.Categories, item.CategoryID)
+	}
+
+	if item.Size != "" {
+		size, err := ParseSize(item.Size)
+		if err == nil {
+			i.Size = size
+		}
+	}
+
+	if item.Trusted != "" {
+		i.Trusted = strings.EqualFold(item.Trusted, "yes")
+	}
+
+	if item.Remake != "" {
+		i.Remake = strings.EqualFold(item.Remake, "yes")
+	}
+}
+
+func magnetFromInfoHash(infoHash, name string) string {
+	magnet := "magnet:?xt=urn:btih:" + infoHash
+	if name != "" {
+		magnet += "&dn=" + url.QueryEscape(name)
+	}
+	return magnet
+}
+
+type AtomFeed struct {
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Updated  string      `xml:"updated"`
+	Links    AtomLinks   `xml:"link"`
+	Entries  []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID        string    `xml:"id"`
+	Title     string    `xml:"title"`
+	Summary   string    `xml:"summary"`
+	Content   string    `xml:"content"`
+	Published string    `xml:"published"`
+	Updated   string    `xml:"updated"`
+	Links     AtomLinks `xml:"link"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+type AtomLinks []AtomLink
+
+// Find returns the first link with the rel, a link without rel is treated as "alternate".
+func (l AtomLinks) Find(rel string) (AtomLink, bool) {
+	for _, v := range l {
+		r := v.Rel
+		if r == "" {
+			r = "alternate"
+		}
+
+		if r == rel {
+			return v, true
+		}
+	}
+
+	return AtomLink{}, false
+}
+
+func (l AtomLinks) Href(rel string) string {
+	link, _ := l.Find(rel)
+	return link.Href
+}
+
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageUrl string         `json:"home_page_url"`
+	FeedUrl     string         `json:"feed_url"`
+	Description string         `json:"description"`
+	NextUrl     string         `json:"next_url"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            string               `json:"id"`
+	Url           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentText   string               `json:"content_text"`
+	ContentHtml   string               `json:"content_html"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+type JSONFeedAttachment struct {
+	Url         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	Title       string `json:"title"`
+	SizeInBytes int64  `json:"size_in_bytes"`
 }
 
 var (
@@ -139,17 +601,28 @@ var (
 		time.RFC1123, time.RFC1123Z, time.RFC3339, time.RFC3339Nano,
 		time.RFC822, time.RFC822Z, time.RFC850, time.Kitchen,
 		"2006-01-02T15:04:05.999999999",
+		"Mon, 2 Jan 2006 15:04:05 MST", "Mon, 2 Jan 2006 15:04:05 -0700",
+		"2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05 MST",
+		time.DateTime, "2006-01-02 15:04", "2006/01/02 15:04:05", "2006/01/02 15:04", time.DateOnly,
 		time.Stamp, time.StampMicro, time.StampMilli, time.StampNano}
 )
 
-// ParseTime parses a string to time.Time.
-// If fails to parse a string, it will return time.Now().
-func ParseTime(s string) time.Time {
-	for k := range timeFormat {
-		t, e := time.Parse(timeFormat[k], s)
-		if e == nil {
-			return t
+// ParseTime parses a string to time.Time, timestamps without zone are treated as UTC.
+func ParseTime(s string) (time.Time, error) {
+	return ParseTimeIn(s, nil, time.UTC)
+}
+
+// ParseTimeIn parses a string by the layouts first and then the builtin formats,
+// timestamps without zone are in the loc.
+func ParseTimeIn(s string, layouts []string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	for _, layout := range append(layouts, timeFormat...) {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, nil
 		}
 	}
-	return time.Now()
+
+	return time.Time{}, fmt.Errorf("unknown time format: %q", s)
 }
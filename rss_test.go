@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
 //go:embed test.xml
@@ -62,3 +72,418 @@ func TestConfig(t *testing.T) {
 
 	t.Log(string(data))
 }
+
+func TestParseAtom(t *testing.T) {
+	atom := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>atom feed</title>
+	<subtitle>atom describe</subtitle>
+	<link href="https://example.com/"/>
+	<link rel="self" href="https://example.com/atom"/>
+	<entry>
+		<id>urn:uuid:1</id>
+		<title>[Group] Show - 01</title>
+		<updated>2024-06-01T10:00:00Z</updated>
+		<published>2024-05-31T10:00:00Z</published>
+		<link rel="alternate" href="https://example.com/view/1"/>
+		<link rel="enclosure" type="application/x-bittorrent" length="1024" href="https://example.com/1.torrent"/>
+	</entry>
+	<entry>
+		<id>urn:uuid:2</id>
+		<title>no enclosure</title>
+		<updated>2024-06-01T10:00:00Z</updated>
+	</entry>
+</feed>`
+
+	chs, err := ParseString(atom)
+	require.NoError(t, err)
+	require.Len(t, chs, 1)
+	require.Equal(t, "atom feed", chs[0].Title)
+	require.Equal(t, "https://example.com/", chs[0].Url)
+	require.Len(t, chs[0].Items, 1)
+
+	item := chs[0].Items[0]
+	require.Equal(t, "[Group] Show - 01", item.Title)
+	require.Equal(t, "https://example.com/1.torrent", item.Url)
+	require.Equal(t, "application/x-bittorrent", item.ContentType)
+	require.Equal(t, "urn:uuid:1", item.GUID)
+	require.Equal(t, time.Date(2024, 5, 31, 10, 0, 0, 0, time.UTC), item.PubDate)
+}
+
+func TestParseJSONFeed(t *testing.T) {
+	feed := `{
+	"version": "https://jsonfeed.org/version/1.1",
+	"title": "json feed",
+	"home_page_url": "https://example.com/",
+	"items": [
+		{
+			"id": "1",
+			"title": "[Group] Show - 01",
+			"date_published": "2024-05-31T10:00:00Z",
+			"attachments": [
+				{"url": "https://example.com/1.torrent", "mime_type": "application/x-bittorrent", "size_in_bytes": 1024}
+			]
+		},
+		{
+			"id": "2",
+			"title": "no attachment"
+		}
+	]
+}`
+
+	chs, err := parseContent("application/feed+json; charset=utf-8", strings.NewReader(feed))
+	require.NoError(t, err)
+	require.Len(t, chs, 1)
+	require.Equal(t, "json feed", chs[0].Title)
+	require.Len(t, chs[0].Items, 1)
+
+	item := chs[0].Items[0]
+	require.Equal(t, "https://example.com/1.torrent", item.Url)
+	require.Equal(t, "application/x-bittorrent", item.ContentType)
+	require.Equal(t, "1", item.GUID)
+	require.Equal(t, time.Date(2024, 5, 31, 10, 0, 0, 0, time.UTC), item.PubDate)
+
+	chs2, err := ParseString(feed)
+	require.NoError(t, err)
+	require.Equal(t, chs, chs2)
+}
+
+func TestParseTorznab(t *testing.T) {
+	feed := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+	<channel>
+		<title>jackett</title>
+		<item>
+			<title>Show S01E01 1080p</title>
+			<enclosure url="https://example.com/dl/1" length="2048" type="application/x-bittorrent"/>
+			<torznab:attr name="seeders" value="12"/>
+			<torznab:attr name="peers" value="20"/>
+			<torznab:attr name="size" value="2048"/>
+			<torznab:attr name="category" value="5000"/>
+			<torznab:attr name="category" value="5040"/>
+			<torznab:attr name="infohash" value="ABCDEF0123456789ABCDEF0123456789ABCDEF01"/>
+		</item>
+		<item>
+			<title>Show S01E02 1080p</title>
+			<torznab:attr name="magneturl" value="magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"/>
+		</item>
+		<item>
+			<title>Show S01E03 1080p</title>
+			<torznab:attr name="infohash" value="1123456789abcdef0123456789abcdef01234567"/>
+		</item>
+	</channel>
+</rss>`
+
+	chs, err := ParseString(feed)
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 3)
+
+	item := chs[0].Items[0]
+	require.Equal(t, 12, item.Seeders)
+	require.Equal(t, 20, item.Peers)
+	require.Equal(t, int64(2048), item.Size)
+	require.Equal(t, []string{"5000", "5040"}, item.Categories)
+	require.Equal(t, "abcdef0123456789abcdef0123456789abcdef01", item.InfoHash)
+	require.Equal(t, "https://example.com/dl/1", item.Url)
+
+	require.Equal(t, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", chs[0].Items[1].Url)
+	require.Equal(t, "magnet:?xt=urn:btih:1123456789abcdef0123456789abcdef01234567&dn=Show+S01E03+1080p", chs[0].Items[2].Url)
+
+	r := &RSS{MinSeeders: 10, Categories: []string{"5040"}}
+	require.True(t, r.MatchAttr(item))
+	require.False(t, r.MatchAttr(chs[0].Items[1]))
+}
+
+func TestParseNyaa(t *testing.T) {
+	feed := `<?xml version="1.0" encoding="utf-8"?>
+<rss xmlns:atom="http://www.w3.org/2005/Atom" xmlns:nyaa="https://nyaa.si/xmlns/nyaa" version="2.0">
+	<channel>
+		<title>Nyaa - Home - Torrent File RSS</title>
+		<item>
+			<title>[Group] Show - 07 [1080p]</title>
+			<link>https://nyaa.si/download/1.torrent</link>
+			<guid isPermaLink="true">https://nyaa.si/view/1</guid>
+			<pubDate>Fri, 31 May 2024 10:00:00 -0000</pubDate>
+			<enclosure url="https://nyaa.si/download/1.torrent" length="1" type="application/x-bittorrent"/>
+			<nyaa:seeders>8</nyaa:seeders>
+			<nyaa:leechers>2</nyaa:leechers>
+			<nyaa:infoHash>ABCDEF0123456789ABCDEF0123456789ABCDEF01</nyaa:infoHash>
+			<nyaa:categoryId>1_2</nyaa:categoryId>
+			<nyaa:category>Anime - English-translated</nyaa:category>
+			<nyaa:size>1.5 GiB</nyaa:size>
+			<nyaa:trusted>Yes</nyaa:trusted>
+			<nyaa:remake>No</nyaa:remake>
+		</item>
+	</channel>
+</rss>`
+
+	chs, err := ParseString(feed)
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 1)
+
+	item := chs[0].Items[0]
+	require.Equal(t, 8, item.Seeders)
+	require.Equal(t, 10, item.Peers)
+	require.Equal(t, "abcdef0123456789abcdef0123456789abcdef01", item.InfoHash)
+	require.Equal(t, []string{"1_2"}, item.Categories)
+	require.Equal(t, int64(1.5*(1<<30)), item.Size)
+	require.True(t, item.Trusted)
+	require.False(t, item.Remake)
+
+	require.True(t, (&RSS{TrustedOnly: true, MinSeeders: 5, Categories: []string{"1_2"}}).MatchAttr(item))
+	require.False(t, (&RSS{MinSeeders: 9}).MatchAttr(item))
+	require.True(t, (&RSS{MinSeeders: 9}).MatchAttr(Item{Title: "no seeders"}))
+}
+
+func TestResolveUrl(t *testing.T) {
+	feed := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">
+	<channel>
+		<title>links</title>
+		<item>
+			<title>link only</title>
+			<link>https://example.com/1.torrent</link>
+			<guid>https://example.com/view/1</guid>
+		</item>
+		<item>
+			<title>page link</title>
+			<link>https://example.com/view/3</link>
+		</item>
+		<item>
+			<title>magnet and torrent</title>
+			<torrent:magnetURI>magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567</torrent:magnetURI>
+			<torrent>
+				<link>https://example.com/2.torrent</link>
+			</torrent>
+		</item>
+	</channel>
+</rss>`
+
+	chs, err := ParseString(feed)
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 3)
+
+	linkOnly := chs[0].Items[0]
+	require.Equal(t, "https://example.com/1.torrent", linkOnly.Url)
+	require.True(t, (&RSS{UrlSources: []string{UrlSourceGUID, UrlSourceLink}}).ResolveUrl(&linkOnly))
+	require.Equal(t, "https://example.com/view/1", linkOnly.Url)
+
+	// the default order only takes links to a torrent or magnet
+	pageLink := chs[0].Items[1]
+	require.Empty(t, pageLink.Url)
+	require.False(t, (&RSS{}).ResolveUrl(&pageLink))
+	require.True(t, (&RSS{UrlSources: []string{UrlSourceLink}}).ResolveUrl(&pageLink))
+	require.Equal(t, "https://example.com/view/3", pageLink.Url)
+
+	both := chs[0].Items[2]
+	require.Equal(t, "https://example.com/2.torrent", both.Url)
+	require.Equal(t, "0123456789abcdef0123456789abcdef01234567", both.InfoHash)
+	require.True(t, (&RSS{UrlSources: []string{UrlSourceMagnet, UrlSourceTorrent}}).ResolveUrl(&both))
+	require.Equal(t, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", both.Url)
+	require.True(t, (&RSS{UrlSources: []string{UrlSourceTorrent, UrlSourceMagnet}}).ResolveUrl(&both))
+	require.Equal(t, "https://example.com/2.torrent", both.Url)
+	require.True(t, (&RSS{UrlSources: []string{UrlSourceTorrent}, PreferMagnet: true}).ResolveUrl(&both))
+	require.Equal(t, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", both.Url)
+}
+
+func TestParseUrlNotModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Fri, 31 May 2024 10:00:00 GMT")
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>test</title></channel></rss>`))
+	}))
+	defer server.Close()
+
+	var meta FeedMeta
+	_, err := ParseUrl(context.Background(), http.DefaultClient, server.URL, &meta, 0)
+	require.NoError(t, err)
+	require.Equal(t, FeedMeta{ETag: `"v1"`, LastModified: "Fri, 31 May 2024 10:00:00 GMT"}, meta)
+
+	_, err = ParseUrl(context.Background(), http.DefaultClient, server.URL, &meta, 0)
+	require.ErrorIs(t, err, ErrNotModified)
+}
+
+func TestParseCharset(t *testing.T) {
+	title := "[字幕组] 测试 - 01"
+
+	gbkTitle, err := simplifiedchinese.GBK.NewEncoder().String(title)
+	require.NoError(t, err)
+
+	feed := `<?xml version="1.0" encoding="GBK"?>
+<rss version="2.0"><channel><title>gbk</title><item><title>` + gbkTitle + `</title><enclosure url="https://example.com/1.torrent" type="application/x-bittorrent"/></item></channel></rss>`
+
+	chs, err := ParseString(feed)
+	require.NoError(t, err)
+	require.Equal(t, title, chs[0].Items[0].Title)
+
+	// the charset of Content-Type takes precedence over the xml declaration
+	sjisTitle, err := japanese.ShiftJIS.NewEncoder().String("テスト - 01")
+	require.NoError(t, err)
+
+	feed = `<?xml version="1.0" encoding="EUC-JP"?>
+<rss version="2.0"><channel><title>sjis</title><item><title>` + sjisTitle + `</title><enclosure url="https://example.com/1.torrent" type="application/x-bittorrent"/></item></channel></rss>`
+
+	chs, err = parseContent("application/rss+xml; charset=Shift_JIS", strings.NewReader(feed))
+	require.NoError(t, err)
+	require.Equal(t, "テスト - 01", chs[0].Items[0].Title)
+}
+
+func TestParseTime(t *testing.T) {
+	tt, err := ParseTime("2024-05-31 10:00:00")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 5, 31, 10, 0, 0, 0, time.UTC), tt)
+
+	tt, err = ParseTime("Fri, 7 Jun 2024 10:00:00 +0800")
+	require.NoError(t, err)
+	require.True(t, time.Date(2024, 6, 7, 2, 0, 0, 0, time.UTC).Equal(tt))
+
+	_, err = ParseTime("yesterday")
+	require.Error(t, err)
+
+	item := Item{}
+	item.SetPubDate("31.05.2024 10:00")
+	require.True(t, item.InvalidPubDate)
+
+	r := &RSS{DateLayout: "02.01.2006 15:04", Timezone: "+09:00"}
+	r.ParsePubDate(&item)
+	require.False(t, item.InvalidPubDate)
+	require.True(t, time.Date(2024, 5, 31, 1, 0, 0, 0, time.UTC).Equal(item.PubDate))
+
+	item.SetPubDate("2024-05-31 10:00:00")
+	(&RSS{Timezone: "Asia/Tokyo"}).ParsePubDate(&item)
+	require.True(t, time.Date(2024, 5, 31, 1, 0, 0, 0, time.UTC).Equal(item.PubDate))
+}
+
+// testTorrent returns a minimal torrent of the files, the keys of the name to length map are the file paths.
+func testTorrent(name string, files map[string]int64) []byte {
+	var info strings.Builder
+	info.WriteString("d5:filesl")
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		fmt.Fprintf(&info, "d6:lengthi%de4:pathl%d:%see", files[path], len(path), path)
+	}
+	fmt.Fprintf(&info, "e4:name%d:%s12:piece lengthi16384e6:pieces20:%se", len(name), name, strings.Repeat("x", 20))
+
+	return []byte("d8:announce13:http://a/anno4:info" + info.String() + "e")
+}
+
+func TestSizeLimit(t *testing.T) {
+	size, err := ParseSize("300MiB")
+	require.NoError(t, err)
+	require.Equal(t, int64(300<<20), size)
+
+	var cc ClientConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"max_feed_size":"1KiB","max_torrent_size":2048}`), &cc))
+	require.Equal(t, Size(1024), cc.MaxFeedSize)
+	require.Equal(t, Size(2048), cc.MaxTorrentSize)
+	require.NoError(t, toml.Unmarshal([]byte("max_feed_size = \"1.5 GiB\"\nmax_torrent_size = 4096"), &cc))
+	require.Equal(t, Size(1.5*(1<<30)), cc.MaxFeedSize)
+	require.Equal(t, Size(4096), cc.MaxTorrentSize)
+	require.Equal(t, "4KiB", FormatSize(int64(cc.MaxTorrentSize)))
+
+	body := strings.Repeat("x", 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>` + body + `</title></channel></rss>`))
+	}))
+	defer server.Close()
+
+	_, err = ParseUrl(context.Background(), http.DefaultClient, server.URL, nil, 1024)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	_, err = ParseUrl(context.Background(), http.DefaultClient, server.URL, nil, 8192)
+	require.NoError(t, err)
+
+	item := Item{Url: server.URL}
+	_, err = item.Get(context.Background(), http.DefaultClient, 1024, false)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	_, err = item.Get(context.Background(), http.DefaultClient, 0, false)
+	require.Error(t, err)
+	require.Less(t, len(err.Error()), 512)
+}
+
+func TestItemGetClassify(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/torrent", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testTorrent("a", map[string]int64{"a.mkv": 1}))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", http.StatusFound)
+	})
+	mux.HandleFunc("/expired", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login.php", http.StatusFound)
+	})
+	mux.HandleFunc("/login.php", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><form><input name="username"><input type="password" name="password"></form></html>`))
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<!DOCTYPE html><html><body>not found</body></html>`))
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"error": "invalid passkey"}`))
+	})
+	mux.HandleFunc("/forbidden", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) (Torrent, error) {
+		item := Item{Url: server.URL + path}
+		return item.Get(context.Background(), http.DefaultClient, 0, false)
+	}
+
+	tr, err := get("/torrent")
+	require.NoError(t, err)
+	require.IsType(t, &TorrentFile{}, tr)
+
+	tr, err = get("/redirect")
+	require.NoError(t, err)
+	require.Equal(t, TorrentHash("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"), tr)
+
+	_, err = get("/expired")
+	require.ErrorIs(t, err, ErrAuthRequired)
+
+	_, err = get("/forbidden")
+	require.ErrorIs(t, err, ErrAuthRequired)
+
+	_, err = get("/html")
+	require.ErrorContains(t, err, "unexpected html page")
+	require.NotErrorIs(t, err, ErrAuthRequired)
+
+	_, err = get("/json")
+	require.ErrorContains(t, err, "tracker error: invalid passkey")
+}
+
+func TestSizeFilter(t *testing.T) {
+	chs, err := ParseString(`<rss version="2.0"><channel><title>size</title>
+<item><title>a</title><enclosure url="https://example.com/a.torrent" length="1073741824" type="application/x-bittorrent"/></item>
+<item><title>b</title><link>https://example.com/b.torrent</link><torrent xmlns="http://xmlns.ezrss.it/0.1/"><contentLength>1024</contentLength></torrent></item>
+</channel></rss>`)
+	require.NoError(t, err)
+	require.Equal(t, int64(1<<30), chs[0].Items[0].Size)
+	require.Equal(t, int64(1024), chs[0].Items[1].Size)
+
+	var r RSS
+	_, err = toml.Decode(`min_size = "300MiB"
+max_size = "4GiB"`, &r)
+	require.NoError(t, err)
+	require.True(t, r.MatchAttr(chs[0].Items[0]))
+	require.False(t, r.MatchAttr(chs[0].Items[1]))
+	require.True(t, r.MatchAttr(Item{}))
+	require.False(t, r.MatchSize(5<<30))
+
+	tr, err := ParseTorrent(testTorrent("a", map[string]int64{"a.mkv": 200 << 20, "b.mkv": 200 << 20}))
+	require.NoError(t, err)
+	require.NoError(t, r.Validate(tr, Item{}))
+
+	tr, err = ParseTorrent(testTorrent("a", map[string]int64{"a.mkv": 1 << 20}))
+	require.NoError(t, err)
+	require.ErrorIs(t, r.Validate(tr, Item{}), ErrRejected)
+}
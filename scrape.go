@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html/charset"
+)
+
+const SourceTypeHTML = "html"
+
+// ScrapeRule extracts the items from a html page, either by css selectors or a regexp.
+type ScrapeRule struct {
+	// Item is the css selector of each item, the other selectors are relative to it.
+	Item      string `json:"item,omitempty" toml:"item"`
+	Title     string `json:"title,omitempty" toml:"title"`
+	TitleAttr string `json:"title_attr,omitempty" toml:"title_attr"`
+	Link      string `json:"link,omitempty" toml:"link"`
+	// LinkAttr is the attribute of the link, default href.
+	LinkAttr string `json:"link_attr,omitempty" toml:"link_attr"`
+	Date     string `json:"date,omitempty" toml:"date"`
+	DateAttr string `json:"date_attr,omitempty" toml:"date_attr"`
+
+	// Regexp is matched against the whole page when Item is empty,
+	// the named groups title, link and date are the fields of the item.
+	Regexp string `json:"regexp,omitempty" toml:"regexp"`
+
+	regexp *regexp.Regexp
+}
+
+// htmlSource fetches a html page and extracts the items by the scrape rule of the feed.
+type htmlSource struct{}
+
+func (htmlSource) Fetch(ctx context.Context, opts FetchOptions) ([]Channel, error) {
+	rule := opts.Rss.Scrape
+	if rule == nil || (rule.Item == "" && rule.Regexp == "") {
+		return nil, fmt.Errorf("scrape rule is required for %s source", SourceTypeHTML)
+	}
+
+	base, err := url.Parse(opts.Rss.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", opts.Rss.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	body, err := charset.NewReader(newLimitedReader(resp.Body, opts.MaxSize), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("decode page failed: %w", err)
+	}
+
+	// the regexp is matched against the page as served, not the re-serialized document
+	page, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read page failed: %w", err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(page)))
+	if err != nil {
+		return nil, fmt.Errorf("parse page failed: %w", err)
+	}
+
+	ch := Channel{
+		Title: strings.TrimSpace(doc.Find("title").First().Text()),
+		Url:   opts.Rss.Url,
+	}
+
+	if rule.Item != "" {
+		ch.Items = rule.scrapeSelector(doc, base)
+	} else {
+		ch.Items, err = rule.scrapeRegexp(string(page), base)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return []Channel{ch}, nil
+}
+
+func (s *ScrapeRule) scrapeSelector(doc *goquery.Document, base *url.URL) []Item {
+	var items []Item
+
+	doc.Find(s.Item).Each(func(_ int, sel *goquery.Selection) {
+		linkAttr := s.LinkAttr
+		if linkAttr == "" {
+			linkAttr = "href"
+		}
+
+		it, ok := newScrapedItem(
+			selectText(sel, s.Title, s.TitleAttr),
+			selectText(sel, s.Link, linkAttr),
+			selectText(sel, s.Date, s.DateAttr),
+			base,
+		)
+		if ok {
+			items = append(items, it)
+		}
+	})
+
+	return items
+}
+
+func (s *ScrapeRule) scrapeRegexp(page string, base *url.URL) ([]Item, error) {
+	if s.regexp == nil {
+		re, err := regexp.Compile(s.Regexp)
+		if err != nil {
+			return nil, fmt.Errorf("compile scrape regexp failed: %w", err)
+		}
+
+		s.regexp = re
+	}
+
+	var items []Item
+
+	for _, match := range s.regexp.FindAllStringSubmatch(page, -1) {
+		group := func(name string) string {
+			if i := s.regexp.SubexpIndex(name); i > 0 {
+				return strings.TrimSpace(html.UnescapeString(match[i]))
+			}
+			return ""
+		}
+
+		it, ok := newScrapedItem(group("title"), group("link"), group("date"), base)
+		if ok {
+			items = append(items, it)
+		}
+	}
+
+	return items, nil
+}
+
+// selectText returns the attribute or the text of the first element matched by the selector,
+// an empty selector means the item element itself.
+func selectText(sel *goquery.Selection, selector, attr string) string {
+	if selector != "" {
+		sel = sel.Find(selector).First()
+	}
+
+	if attr != "" {
+		v, _ := sel.Attr(attr)
+		return strings.TrimSpace(v)
+	}
+
+	return strings.TrimSpace(sel.Text())
+}
+
+func newScrapedItem(title, link, date string, base *url.URL) (Item, bool) {
+	if link == "" {
+		return Item{}, false
+	}
+
+	it := Item{Title: title}
+
+	if strings.HasPrefix(link, "magnet:?") {
+		it.AddLink(UrlSourceMagnet, link, "")
+	} else {
+		uri, err := base.Parse(link)
+		if err != nil {
+			return Item{}, false
+		}
+
+		it.AddLink(UrlSourceEnclosure, uri.String(), "")
+	}
+
+	if it.Title == "" {
+		it.Title = link
+	}
+
+	if date != "" {
+		it.SetPubDate(date)
+	}
+
+	it.ResolveUrl(nil, false)
+
+	return it, true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLSource(t *testing.T) {
+	page := `<html><head><title>listing</title></head><body><table>
+<tr class="item"><td class="name">[Group] Show - 01</td><td><a href="/dl/1.torrent">dl</a></td><td><span title="2024-05-31 10:00:00">1 day ago</span></td></tr>
+<tr class="item"><td class="name">[Group] Show - 02</td><td><a href="magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&amp;dn=02">dl</a></td></tr>
+<tr class="item"><td class="name">no link</td></tr>
+<tr class='item'><td class='name'>Show &amp; Friends - 03</td><td><a href='/dl/3.torrent?a=1&amp;b=2'>dl</a></td></tr>
+</table></body></html>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	r := &RSS{
+		Type: SourceTypeHTML,
+		Url:  server.URL + "/list",
+		Scrape: &ScrapeRule{
+			Item:     "tr.item",
+			Title:    "td.name",
+			Link:     "a",
+			Date:     "span",
+			DateAttr: "title",
+		},
+	}
+
+	source, err := r.Source()
+	require.NoError(t, err)
+
+	chs, err := source.Fetch(context.Background(), FetchOptions{Rss: r, Client: http.DefaultClient})
+	require.NoError(t, err)
+	require.Equal(t, "listing", chs[0].Title)
+	require.Len(t, chs[0].Items, 3)
+	require.Equal(t, "[Group] Show - 01", chs[0].Items[0].Title)
+	require.Equal(t, server.URL+"/dl/1.torrent", chs[0].Items[0].Url)
+	require.Equal(t, time.Date(2024, 5, 31, 10, 0, 0, 0, time.UTC), chs[0].Items[0].PubDate)
+	require.Equal(t, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=02", chs[0].Items[1].Url)
+	require.Equal(t, "Show & Friends - 03", chs[0].Items[2].Title)
+	require.Equal(t, server.URL+"/dl/3.torrent?a=1&b=2", chs[0].Items[2].Url)
+
+	r.Scrape = &ScrapeRule{Regexp: `<td class="name">(?P<title>[^<]+)</td><td><a href="(?P<link>[^"]+)"`}
+
+	chs, err = source.Fetch(context.Background(), FetchOptions{Rss: r, Client: http.DefaultClient})
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 2)
+	require.Equal(t, "[Group] Show - 02", chs[0].Items[1].Title)
+	require.Equal(t, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=02", chs[0].Items[1].Url)
+
+	// the regexp sees the page as served, single quotes and entities included
+	r.Scrape = &ScrapeRule{Regexp: `<td class='name'>(?P<title>[^<]+)</td><td><a href='(?P<link>[^']+)'`}
+
+	chs, err = source.Fetch(context.Background(), FetchOptions{Rss: r, Client: http.DefaultClient})
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 1)
+	require.Equal(t, "Show & Friends - 03", chs[0].Items[0].Title)
+	require.Equal(t, server.URL+"/dl/3.torrent?a=1&b=2", chs[0].Items[0].Url)
+}
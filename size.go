@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a human readable size like "300MiB", "1.2 GiB" or "1024" to bytes.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i == -1 {
+		i = len(s)
+	}
+
+	number, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit %q", s)
+	}
+
+	return int64(number * unit), nil
+}
+
+// Size is a size in bytes, it's configured by a human readable string like "10MiB" or a number.
+type Size int64
+
+func (s *Size) UnmarshalText(text []byte) error {
+	size, err := ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*s = Size(size)
+	return nil
+}
+
+// UnmarshalJSON accepts both a string and a number.
+func (s *Size) UnmarshalJSON(data []byte) error {
+	if str, err := strconv.Unquote(string(data)); err == nil {
+		return s.UnmarshalText([]byte(str))
+	}
+
+	return s.UnmarshalText(data)
+}
+
+func (s Size) MarshalText() ([]byte, error) {
+	return []byte(FormatSize(int64(s))), nil
+}
+
+// FormatSize formats the size by the largest binary unit that divides it.
+func FormatSize(size int64) string {
+	for _, unit := range []struct {
+		name string
+		size int64
+	}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if size != 0 && size%unit.size == 0 {
+			return strconv.FormatInt(size/unit.size, 10) + unit.name
+		}
+	}
+
+	return strconv.FormatInt(size, 10)
+}
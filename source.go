@@ -0,0 +1,191 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Source fetches the channels of a feed.
+type Source interface {
+	Fetch(ctx context.Context, opts FetchOptions) ([]Channel, error)
+}
+
+type FetchOptions struct {
+	Rss    *RSS
+	Client HTTPClient
+	// Meta is the validators of the last response, sources update it if they support conditional requests.
+	Meta *FeedMeta
+	// MaxSize is the size limit of the feed, zero means no limit.
+	MaxSize int64
+}
+
+// LocalSource is implemented by sources that read the local files,
+// only their items may download the torrents by file:// urls.
+type LocalSource interface {
+	Local() bool
+}
+
+func isLocalSource(s Source) bool {
+	l, ok := s.(LocalSource)
+	return ok && l.Local()
+}
+
+// SourceCommitter is implemented by sources that need to know when an item is added.
+type SourceCommitter interface {
+	Commit(rss *RSS, item Item) error
+}
+
+const SourceTypeRSS = "rss"
+
+// sources is the registry of sources, keyed by the type of RSS or the scheme of the url.
+var sources = map[string]Source{
+	SourceTypeRSS:  httpSource{},
+	"http":         httpSource{},
+	"https":        httpSource{},
+	SourceTypeFile: fileSource{},
+	SourceTypeDir:  dirSource{},
+	SourceTypeHTML: htmlSource{},
+}
+
+// RegisterSource registers a source by the type or url scheme, it should be called in init.
+func RegisterSource(name string, source Source) {
+	sources[name] = source
+}
+
+// Source returns the source of the feed by its type, or the scheme of the url when type is empty.
+func (r *RSS) Source() (Source, error) {
+	name := r.Type
+	if name == "" {
+		uri, err := url.Parse(r.Url)
+		if err != nil {
+			return nil, fmt.Errorf("parse url failed: %w", err)
+		}
+
+		name = uri.Scheme
+	}
+
+	source, ok := sources[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported source type: %s", name)
+	}
+
+	return source, nil
+}
+
+// httpSource is the default source, it fetches RSS, Atom or JSON Feed by http.
+type httpSource struct{}
+
+func (h httpSource) Fetch(ctx context.Context, opts FetchOptions) ([]Channel, error) {
+	if opts.Rss.Backfill && opts.Meta != nil && !opts.Meta.Backfilled {
+		return h.backfill(ctx, opts)
+	}
+
+	return ParseUrl(ctx, opts.Client, opts.Rss.Url, opts.Meta, opts.MaxSize)
+}
+
+// backfill follows the next pages until download_after is reached or there is no next page,
+// the items of all pages are merged into one channel from oldest to newest.
+func (httpSource) backfill(ctx context.Context, opts FetchOptions) ([]Channel, error) {
+	var (
+		merged Channel
+		seen   = make(map[string]bool)
+		next   = opts.Rss.Url
+	)
+
+	for page := 0; page < opts.Rss.backfillPages() && next != ""; page++ {
+		if page > 0 {
+			time.Sleep(time.Millisecond * time.Duration(opts.Rss.FetchInterval))
+		}
+
+		meta := &FeedMeta{}
+		chs, err := ParseUrl(ctx, opts.Client, next, meta, opts.MaxSize)
+		if err != nil {
+			if page == 0 {
+				return nil, err
+			}
+
+			slog.Error("backfill page failed", "err", err, "url", next, "name", opts.Rss.Name, "page", page)
+			break
+		}
+
+		if page == 0 {
+			// keep the fingerprint of the feed, only the validators of the first page are updated
+			opts.Meta.ETag, opts.Meta.LastModified = meta.ETag, meta.LastModified
+			if len(chs) > 0 {
+				merged = chs[0]
+				merged.Items = nil
+			}
+		}
+
+		reached := false
+		current := next
+		next = ""
+
+		for _, ch := range chs {
+			for _, item := range ch.Items {
+				if !opts.Rss.MatchDate(item.PubDate) {
+					reached = true
+				}
+
+				// the items without url or guid are resolved later by url_sources, they can't be deduplicated
+				key := cmp.Or(item.Url, item.GUID)
+				if key != "" && seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				merged.Items = append(merged.Items, item)
+			}
+
+			if next == "" {
+				next = nextPage(current, ch)
+			}
+		}
+
+		slog.Info("backfill page", "url", current, "name", opts.Rss.Name, "page", page)
+
+		if reached || len(chs) == 0 {
+			break
+		}
+	}
+
+	slices.SortStableFunc(merged.Items, func(a, b Item) int { return a.PubDate.Compare(b.PubDate) })
+
+	merged.Next = ""
+	merged.NextOffset = 0
+	opts.Meta.Backfilled = true
+
+	return []Channel{merged}, nil
+}
+
+// nextPage returns the url of the next page, by the next link or the torznab offset.
+func nextPage(current string, ch Channel) string {
+	base, err := url.Parse(current)
+	if err != nil {
+		return ""
+	}
+
+	if ch.Next != "" {
+		next, err := base.Parse(ch.Next)
+		if err != nil || next.String() == current {
+			return ""
+		}
+
+		return next.String()
+	}
+
+	if ch.NextOffset > 0 {
+		query := base.Query()
+		query.Set("offset", strconv.Itoa(ch.NextOffset))
+		base.RawQuery = query.Encode()
+		return base.String()
+	}
+
+	return ""
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+type testSource []Channel
+
+func (s testSource) Fetch(ctx context.Context, opts FetchOptions) ([]Channel, error) { return s, nil }
+
+func TestSource(t *testing.T) {
+	source, err := (&RSS{Url: "https://example.com/rss"}).Source()
+	require.NoError(t, err)
+	require.Equal(t, httpSource{}, source)
+
+	_, err = (&RSS{Url: "test://example"}).Source()
+	require.Error(t, err)
+
+	RegisterSource("test", testSource{{Title: "test"}})
+	t.Cleanup(func() { delete(sources, "test") })
+
+	source, err = (&RSS{Url: "test://example"}).Source()
+	require.NoError(t, err)
+
+	chs, err := source.Fetch(context.Background(), FetchOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "test", chs[0].Title)
+
+	source, err = (&RSS{Type: "test", Url: "https://example.com/rss"}).Source()
+	require.NoError(t, err)
+	require.IsType(t, testSource{}, source)
+}
+
+func TestBackfill(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		var items strings.Builder
+		for i := offset; i < offset+2 && i < 6; i++ {
+			fmt.Fprintf(&items, `<item><title>Show - %02d</title><pubDate>%s</pubDate><enclosure url="http://example.com/%d.torrent"/></item>`,
+				6-i, time.Date(2024, 6, 6-i, 0, 0, 0, 0, time.UTC).Format(time.RFC1123Z), 6-i)
+		}
+
+		fmt.Fprintf(w, `<rss version="2.0" xmlns:newznab="http://www.newznab.com/DTD/2010/feeds/attributes/"><channel><title>torznab</title>
+<newznab:response offset="%d" total="6"/>%s</channel></rss>`, offset, items.String())
+	}))
+	defer server.Close()
+
+	r := &RSS{Url: server.URL + "/api?t=search", Backfill: true, DownloadAfter: time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC).Unix()}
+
+	meta := &FeedMeta{}
+	chs, err := httpSource{}.Fetch(context.Background(), FetchOptions{Rss: r, Client: http.DefaultClient, Meta: meta})
+	require.NoError(t, err)
+	require.True(t, meta.Backfilled)
+	require.Len(t, chs, 1)
+
+	titles := lo.Map(chs[0].Items, func(item Item, _ int) string { return item.Title })
+	require.Equal(t, []string{"Show - 01", "Show - 02", "Show - 03", "Show - 04", "Show - 05", "Show - 06"}, titles)
+
+	// the page cap stops the backfill, and the next fetch is a normal one
+	r.DownloadAfter = 0
+	r.BackfillPages = 2
+	meta = &FeedMeta{}
+	chs, err = httpSource{}.Fetch(context.Background(), FetchOptions{Rss: r, Client: http.DefaultClient, Meta: meta})
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 4)
+
+	chs, err = httpSource{}.Fetch(context.Background(), FetchOptions{Rss: r, Client: http.DefaultClient, Meta: meta})
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 2)
+
+	// the items resolved later by url_sources are not merged
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>links</title>
+<item><title>a</title><link>https://example.com/view/1</link></item>
+<item><title>b</title><link>https://example.com/view/2</link></item></channel></rss>`))
+	}))
+	defer server.Close()
+
+	meta = &FeedMeta{}
+	chs, err = httpSource{}.Fetch(context.Background(), FetchOptions{Rss: &RSS{Url: server.URL, Backfill: true}, Client: http.DefaultClient, Meta: meta})
+	require.NoError(t, err)
+	require.Len(t, chs[0].Items, 2)
+
+	require.Equal(t, "https://example.com/feed?page=2", nextPage("https://example.com/feed", Channel{Next: "?page=2"}))
+	require.Empty(t, nextPage("https://example.com/feed", Channel{}))
+}
+
+func TestBackfillOnce(t *testing.T) {
+	var requests, pages atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset > 0 {
+			pages.Add(1)
+		}
+
+		var items strings.Builder
+		for i := offset; i < offset+2 && i < 6; i++ {
+			fmt.Fprintf(&items, `<item><title>Show - %02d</title><enclosure url="http://example.com/%d.torrent"/></item>`, 6-i, 6-i)
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintf(w, `<rss version="2.0" xmlns:newznab="http://www.newznab.com/DTD/2010/feeds/attributes/"><channel><title>torznab</title>
+<newznab:response offset="%d" total="6"/>%s</channel></rss>`, offset, items.String())
+	}))
+	defer server.Close()
+
+	cache, err := NewCacheByPath(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer cache.Close()
+
+	config := &Config{Rss: []*RSS{{Name: "backfill", Url: server.URL + "/api", Backfill: true, Regexp: []string{"^nomatch$"}}}}
+	j := NewJob(nil, cache)
+
+	j.DoOne(config)
+	require.Equal(t, int32(3), requests.Load())
+	require.Equal(t, int32(2), pages.Load())
+
+	meta, ok := cache.LoadFeedMeta(config.Rss[0].Url)
+	require.True(t, ok)
+	require.True(t, meta.Backfilled)
+	require.Equal(t, config.Rss[0].Fingerprint(), meta.Fingerprint)
+
+	// the second run is a conditional request without backfill
+	j.DoOne(config)
+	require.Equal(t, int32(4), requests.Load())
+	require.Equal(t, int32(2), pages.Load())
+}
@@ -31,3 +31,24 @@ func (t *Transmission) Add(ctx context.Context, files Torrent, downloadDir strin
 	_, err := t.cli.TorrentAdd(context.TODO(), files.AddPayload(downloadDir, label))
 	return err
 }
+
+// Remove removes the torrent of the infohash, it's a no-op when the torrent doesn't exist.
+func (t *Transmission) Remove(ctx context.Context, infoHash string, deleteData bool) error {
+	torrents, err := t.cli.TorrentGetHashes(ctx, []string{"id"}, []string{infoHash})
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(torrents))
+	for _, v := range torrents {
+		if v.ID != nil {
+			ids = append(ids, *v.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return t.cli.TorrentRemove(ctx, transmissionrpc.TorrentRemovePayload{IDs: ids, DeleteLocalData: deleteData})
+}
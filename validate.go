@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ErrRejected is returned when a torrent fails the validation of the feed,
+// the rejected items are recorded in the cache so they are not downloaded again.
+var ErrRejected = errors.New("torrent rejected")
+
+var dangerousExtensions = map[string]bool{
+	".exe": true, ".scr": true, ".lnk": true, ".bat": true, ".cmd": true, ".com": true,
+	".pif": true, ".vbs": true, ".vbe": true, ".jse": true, ".wsf": true, ".wsh": true,
+	".msi": true, ".ps1": true, ".hta": true, ".cpl": true,
+}
+
+var archiveExtensions = map[string]bool{
+	".rar": true, ".zip": true, ".7z": true, ".tar": true, ".gz": true, ".001": true,
+}
+
+// splitRarExt matches the volumes of split rar archives, like .r00.
+var splitRarExt = regexp.MustCompile(`^\.r\d\d$`)
+
+func isArchive(ext string) bool {
+	return archiveExtensions[ext] || splitRarExt.MatchString(ext)
+}
+
+// Validate checks the torrent by the validation options and the size limit of the feed before it's added.
+// Magnet links have no file list, so only the infohash of them is checked.
+// A password protected archive can't be told from the file list, it's approximated by
+// an archive only payload, so a protected .rar next to a sample or .nfo still passes.
+func (r *RSS) Validate(tr Torrent, item Item) error {
+	if r.VerifyInfoHash && item.InfoHash != "" && !strings.EqualFold(tr.InfoHash(), item.InfoHash) {
+		return fmt.Errorf("%w: infohash %s doesn't match %s of the feed", ErrRejected, tr.InfoHash(), item.InfoHash)
+	}
+
+	tf, ok := tr.(*TorrentFile)
+	if !ok || tf.Torrent == nil {
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(r.AllowedExtensions))
+	for _, v := range r.AllowedExtensions {
+		allowed["."+strings.TrimPrefix(strings.ToLower(v), ".")] = true
+	}
+
+	var total int64
+	for _, f := range tf.Torrent.Files {
+		total += f.Length
+	}
+
+	if !r.MatchSize(total) {
+		return fmt.Errorf("%w: size %s is out of the limit", ErrRejected, FormatSize(total))
+	}
+
+	archives := 0
+
+	for _, f := range tf.Torrent.Files {
+		name := path.Join(f.Path...)
+		ext := strings.ToLower(path.Ext(name))
+
+		if r.BlockDangerous && dangerousExtensions[ext] {
+			return fmt.Errorf("%w: dangerous file %s", ErrRejected, name)
+		}
+
+		if len(allowed) > 0 && !allowed[ext] {
+			return fmt.Errorf("%w: file extension of %s is not allowed", ErrRejected, name)
+		}
+
+		if isArchive(ext) {
+			archives++
+		}
+	}
+
+	if r.BlockDangerous && archives > 0 && archives == len(tf.Torrent.Files) {
+		return fmt.Errorf("%w: archive only payload", ErrRejected)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	parse := func(files map[string]int64) Torrent {
+		tr, err := ParseTorrent(testTorrent("a", files))
+		require.NoError(t, err)
+		return tr
+	}
+
+	r := &RSS{BlockDangerous: true}
+	require.NoError(t, r.Validate(parse(map[string]int64{"a.mkv": 1, "a.rar": 1}), Item{}))
+	require.ErrorIs(t, r.Validate(parse(map[string]int64{"a.mkv": 1, "setup.EXE": 1}), Item{}), ErrRejected)
+	require.ErrorIs(t, r.Validate(parse(map[string]int64{"a.rar": 1, "a.r00": 1}), Item{}), ErrRejected)
+	require.NoError(t, r.Validate(TorrentHash("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"), Item{}))
+
+	r = &RSS{AllowedExtensions: []string{"MKV", ".ass"}}
+	require.NoError(t, r.Validate(parse(map[string]int64{"a.mkv": 1, "a.ass": 1}), Item{}))
+	require.ErrorIs(t, r.Validate(parse(map[string]int64{"a.mkv": 1, "a.txt": 1}), Item{}), ErrRejected)
+
+	tr := parse(map[string]int64{"a.mkv": 1})
+	r = &RSS{VerifyInfoHash: true}
+	require.NoError(t, r.Validate(tr, Item{InfoHash: strings.ToUpper(tr.(*TorrentFile).Torrent.InfoHash)}))
+	require.ErrorIs(t, r.Validate(tr, Item{InfoHash: "0123456789abcdef0123456789abcdef01234567"}), ErrRejected)
+}
@@ -57,3 +57,44 @@ func WatchConfig(ctx context.Context, file string, do func()) error {
 		}
 	}
 }
+
+// WatchDir calls do when files are created or written in the directory,
+// the events are debounced so a batch of files only calls do once.
+func WatchDir(ctx context.Context, dir string, do func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	err = watcher.Add(dir)
+	if err != nil {
+		return err
+	}
+
+	timer := time.AfterFunc(time.Hour, do)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			timer.Reset(time.Second * 3)
+		}
+	}
+}
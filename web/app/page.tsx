@@ -7,8 +7,15 @@ import { useState } from "react";
 import useSWR from "swr";
 import { DeleteIcon, EditIcon, PlusIcon } from "./icons";
 
+type FeedError = {
+  error: string;
+  auth_required?: boolean;
+  time: string;
+}
+
 type Status = {
   running: boolean;
+  errors?: { [name: string]: FeedError };
 }
 
 type RSS = {
@@ -459,9 +466,20 @@ export default function Home() {
                 <TableCell>{i}</TableCell>
                 <TableCell>{rss.name}</TableCell>
                 <TableCell>
-                  <Chip className="capitalize" color={rss.disabled ? "danger" : "success"} size="sm" variant="flat">
-                    {rss.disabled ? "Disabled" : "Enabled"}
-                  </Chip>
+                  <div className="flex items-center gap-2">
+                    <Chip className="capitalize" color={rss.disabled ? "danger" : "success"} size="sm" variant="flat">
+                      {rss.disabled ? "Disabled" : "Enabled"}
+                    </Chip>
+                    {
+                      status?.errors?.[rss.name] && (
+                        <Tooltip content={`${new Date(status.errors[rss.name].time).toLocaleString()}: ${status.errors[rss.name].error}`}>
+                          <Chip color="warning" size="sm" variant="flat">
+                            {status.errors[rss.name].auth_required ? "Authentication Required" : "Error"}
+                          </Chip>
+                        </Tooltip>
+                      )
+                    }
+                  </div>
                 </TableCell>
                 <TableCell>
                   <div className="relative flex items-center gap-2">